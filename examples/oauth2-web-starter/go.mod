@@ -13,4 +13,5 @@ require (
 	cloud.google.com/go v0.67.0 // indirect
 	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
 	golang.org/x/oauth2 v0.22.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -51,11 +51,8 @@ func main() {
 	providerRegistry := getProviderRegistry()
 
 	r := chi.NewRouter()
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		if _, ok, err := sessionCtl.Get(r.Context(), r); err != nil {
-			handleInternalError(err, w)
-			return
-		} else if ok {
+	r.With(sessionCtl.LoadSession).Get("/", func(w http.ResponseWriter, r *http.Request) {
+		if oauth2.SessionFromContext(r.Context()) != nil {
 			t, _ := template.New("authenticated").Parse(indexAuthTpl)
 			t.Execute(w, providerRegistry)
 			return
@@ -72,80 +69,22 @@ func main() {
 		}
 	})
 
-	r.Get("/u/auth/{provider}", func(w http.ResponseWriter, r *http.Request) {
-		name := chi.URLParam(r, "provider")
-		auth, err := svc.NewAuthenticator(name)
-		if err != nil {
-			handleInternalError(err, w)
-			return
-		}
-
-		config := oauth2.AuthConfig{
-			Audience:    audience,
-			RedirectURL: r.URL.Query().Get("redirect_to"),
-		}
-
-		if err := auth.Start(w, r, config); err != nil {
-			handleInternalError(err, w)
-		}
-	})
-
-	r.Get("/u/auth/{provider}/callback", func(w http.ResponseWriter, r *http.Request) {
-		name := chi.URLParam(r, "provider")
-		auth, err := svc.NewAuthenticator(name)
-		if err != nil {
-			handleInternalError(err, w)
-			return
-		}
-
-		result, err := auth.Complete(w, r)
-		if err != nil {
-			handleInternalError(err, w)
-			return
-		}
-
-		sid, err := sessionCtl.Set(r.Context(), w, *result)
-		if err != nil {
-			handleInternalError(err, w)
-			return
-		}
-
-		log.Printf("Session created: %s\n", sid)
-
-		if result.RedirectURL != "" {
-			http.Redirect(w, r, result.RedirectURL, http.StatusTemporaryRedirect)
-		}
-	})
-
-	r.Get("/u/profile", func(w http.ResponseWriter, r *http.Request) {
-		sess, ok, err := sessionCtl.Get(r.Context(), r)
-		if err != nil {
-			handleInternalError(err, w)
-			return
-		} else if !ok {
-			http.Error(w, "Not Authenticated", http.StatusUnauthorized)
-			return
-		}
+	// Serves the login, callback and logout routes.
+	authHandler := svc.Handler(sessionCtl)
+	r.Handle("/u/auth/*", authHandler)
+	r.Handle("/u/logout", authHandler)
 
+	requireAuth := sessionCtl.RequireAuth(oauth2.WithLoginURL("/"))
+	r.With(requireAuth).Get("/u/profile", func(w http.ResponseWriter, r *http.Request) {
 		t, err := template.New("profile").Parse(profileTpl)
 		if err != nil {
 			handleInternalError(err, w)
 			return
 		}
 
-		if err := t.Execute(w, sess); err != nil {
-			handleInternalError(err, w)
-		}
-	})
-
-	r.Get("/u/logout", func(w http.ResponseWriter, r *http.Request) {
-		if err := sessionCtl.Del(r.Context(), w, r); err != nil {
+		if err := t.Execute(w, oauth2.SessionFromContext(r.Context())); err != nil {
 			handleInternalError(err, w)
-			return
 		}
-
-		w.Header().Set("Location", "/")
-		w.WriteHeader(http.StatusTemporaryRedirect)
 	})
 
 	log.Println("listening on :" + port)
@@ -188,12 +127,16 @@ var indexAnonTpl = `
 `
 
 var indexAuthTpl = `
-<p><strong>[Authenticated]</strong> <a href="/u/logout">Log out</a></p>
+<form method="post" action="/u/logout">
+  <p><strong>[Authenticated]</strong> <button type="submit">Log out</button></p>
+</form>
 <p>View <a href="/u/profile">profile</a></p>
 `
 
 var profileTpl = `
-<p><a href="/">Home</a> | <a href="/u/logout">Log out</a></p>
+<form method="post" action="/u/logout">
+  <p><a href="/">Home</a> | <button type="submit">Log out</button></p>
+</form>
 <p>ID: <code>{{.Profile.ID}}</code></p>
 <p>Name: {{.Profile.FirstName}} {{.Profile.LastName}} ({{.Profile.Name}})</p>
 <p>Email: <code>{{.Profile.Email}}</code></p>
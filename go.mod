@@ -5,6 +5,7 @@ go 1.21
 require (
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	golang.org/x/oauth2 v0.22.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require cloud.google.com/go v0.67.0 // indirect
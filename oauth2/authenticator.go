@@ -1,35 +1,81 @@
 package oauth2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+
+	"golang.org/x/oauth2"
 )
 
 type authenticator struct {
 	svcConf  *ServiceConfig
 	session  SessionManager
 	provider Provider
+	keySets  *keySetCache
 }
 
 func (sa *authenticator) Start(w http.ResponseWriter, r *http.Request, config AuthConfig) error {
+	if err := sa.svcConf.Hooks.loginStart(r.Context(), sa.provider.Name(), &config); err != nil {
+		return err
+	}
+
+	if config.LinkUserID != "" && sa.svcConf.IdentityStore == nil {
+		return ErrNoIdentityStore
+	}
+
+	config.RedirectURL = sa.svcConf.RedirectPolicy.sanitize(sa.svcConf.BaseURL,
+		config.RedirectURL)
+
 	auth, err := sa.session.Set(w, r, config)
 	if err != nil {
 		return fmt.Errorf("failed to create authentication session: %w", err)
 	}
 
+	var opts []oauth2.AuthCodeOption
+	if optioner, ok := sa.provider.(AuthCodeOptioner); ok {
+		opts = optioner.AuthCodeOptions()
+	}
+	opts = append(opts, config.authCodeOptions()...)
+	if auth.Verifier != "" {
+		opts = append(opts, oauth2.S256ChallengeOption(auth.Verifier))
+	}
+	if sa.provider.Endpoints().SupportsOIDC() {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", auth.Nonce))
+	}
+
 	conf := sa.provider.Configure(sa.svcConf)
-	// We may want to support AccessTypeOffline if we ever want the server to return a refresh
-	// token.  As it stands, a refresh token is not issued.
-	loginURL := conf.AuthCodeURL(auth.State)
+	conf.Scopes = mergeScopes(conf.Scopes, auth.Scopes)
+	loginURL := conf.AuthCodeURL(auth.State, opts...)
 	http.Redirect(w, r, loginURL, http.StatusFound)
 	return nil
 }
 
+// Complete finishes the authentication when the provider redirects the user back.  The
+// authorization response is read from the query string or, when posted back with
+// response_mode=form_post, from the request body.  Errors reported by the provider, in the callback
+// or when the code is exchanged, are returned as a *ProviderError.
 func (sa *authenticator) Complete(w http.ResponseWriter, r *http.Request) (
 	*AuthResult, error) {
-	receivedState := r.URL.Query().Get("state")
+	result, err := sa.complete(w, r)
+	if err != nil {
+		sa.svcConf.Hooks.loginFailure(r.Context(), sa.provider.Name(), err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (sa *authenticator) complete(w http.ResponseWriter, r *http.Request) (
+	*AuthResult, error) {
+	params, err := callbackParams(r)
+	if err != nil {
+		return nil, err
+	}
+
+	receivedState := params.Get("state")
 	if receivedState == "" {
 		return nil, ErrStateMissing
 	}
@@ -43,21 +89,182 @@ func (sa *authenticator) Complete(w http.ResponseWriter, r *http.Request) (
 		// log.Printf("failed to delete auth session: %s", err.Error())
 	}
 
-	code := r.URL.Query().Get("code")
+	if err := callbackError(params); err != nil {
+		return nil, err
+	}
+
+	code := params.Get("code")
 	if code == "" {
-		return nil, fmt.Errorf("code query parameter is missing")
+		return nil, ErrCodeMissing
+	}
+
+	var opts []oauth2.AuthCodeOption
+	if session.Verifier != "" {
+		opts = append(opts, oauth2.VerifierOption(session.Verifier))
 	}
 
 	conf := sa.provider.Configure(sa.svcConf)
-	token, err := conf.Exchange(r.Context(), code)
+	conf.Scopes = mergeScopes(conf.Scopes, session.Scopes)
+	token, err := conf.Exchange(r.Context(), code, opts...)
+	if err != nil {
+		return nil, wrapProviderError("authentication exchange failed", err)
+	}
+
+	result, err := buildAuthResult(r.Context(), sa.provider, sa.keySets, conf, token,
+		idTokenExpectation{Nonce: session.Nonce, MaxAge: session.MaxAge}, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// The policy is enforced again since custom session managers may not protect the URL from
+	// tampering.
+	result.RedirectURL = sa.svcConf.RedirectPolicy.sanitize(sa.svcConf.BaseURL,
+		session.RedirectURL)
+	if err := finishAuthResult(r.Context(), sa.svcConf, result, session.LinkUserID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// callbackParams returns the parameters of the authorization response, which are posted in the
+// request body when response_mode=form_post is in effect and otherwise carried in the query string.
+func callbackParams(r *http.Request) (url.Values, error) {
+	if r.Method != http.MethodPost {
+		return r.URL.Query(), nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("failed to parse callback form: %w", err)
+	}
+	return r.PostForm, nil
+}
+
+// buildAuthResult verifies the ID token included in the token response, if any, and extracts the
+// user's profile, yielding the result of an authentication regardless of the grant that produced
+// the token.  The callback parameters are nil unless the token was obtained through the
+// authorization code grant.
+func buildAuthResult(ctx context.Context, provider Provider, keySets *keySetCache,
+	conf oauth2.Config, token *oauth2.Token, expect idTokenExpectation,
+	callback url.Values) (*AuthResult, error) {
+	idToken, err := verifyTokenResponse(ctx, provider, keySets, conf, token, expect)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := extractProfile(ctx, provider, conf, token, idToken, callback)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract profile: %w", err)
+	}
+
+	return &AuthResult{
+		Provider: provider.Name(),
+		Profile:  profile,
+		Token:    *token,
+		IDToken:  idToken,
+		Scopes:   grantedScopes(token, conf.Scopes)}, nil
+}
+
+// finishAuthResult applies the service's email policy to the result, resolves and persists the
+// user it authenticates when so configured, and finally hands it to the OnLoginSuccess hook.
+func finishAuthResult(ctx context.Context, svcConf *ServiceConfig, result *AuthResult,
+	linkUserID string) error {
+	if err := svcConf.EmailPolicy.apply(&result.Profile); err != nil {
+		return err
+	}
+
+	if svcConf.IdentityStore != nil {
+		if err := resolveUser(ctx, svcConf.IdentityStore, result, linkUserID); err != nil {
+			return err
+		}
+	} else if linkUserID != "" {
+		return ErrNoIdentityStore
+	}
+
+	if svcConf.UserStore != nil {
+		if err := upsertUser(ctx, svcConf.UserStore, svcConf.IdentityStore, result); err != nil {
+			return err
+		}
+	}
+
+	return svcConf.Hooks.loginSuccess(ctx, result)
+}
+
+// extractProfile builds the user's profile through the provider's TokenProfileExtractor, if it
+// implements one, or else from the payload fetched from its ProfileURL or, in the absence of one,
+// the ID token's claims.  The profile is then handed to the provider's ProfileEnricher, if any.
+func extractProfile(ctx context.Context, provider Provider, conf oauth2.Config,
+	token *oauth2.Token, idToken *IDToken, callback url.Values) (Profile, error) {
+	client := conf.Client(ctx, token)
+
+	var profile Profile
+	var err error
+	profileURL := provider.Endpoints().ProfileURL
+	if tpe, ok := provider.(TokenProfileExtractor); ok {
+		profile, err = tpe.ExtractTokenProfile(token, idToken, callback)
+	} else if profileURL == "" && idToken != nil {
+		profile, err = provider.ExtractProfile(idToken.Claims, nil)
+	} else {
+		var profileMap ProfileMap
+		var profileRaw []byte
+		if profileMap, profileRaw, err = fetchProfile(client, profileURL); err == nil {
+			if err = checkProfileSubject(profileMap, idToken); err == nil {
+				profile, err = provider.ExtractProfile(profileMap, profileRaw)
+			}
+		}
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if pe, ok := provider.(ProfileEnricher); ok {
+		if err := pe.EnrichProfile(ctx, client, idToken, &profile); err != nil {
+			return Profile{}, err
+		}
+	}
+	return profile, nil
+}
+
+// checkProfileSubject ensures that the profile fetched from the provider, when it carries a sub
+// claim as OpenID Connect UserInfo responses do, belongs to the subject of the verified ID token.
+func checkProfileSubject(profile ProfileMap, idToken *IDToken) error {
+	if idToken == nil {
+		return nil
+	} else if _, ok := profile["sub"]; !ok {
+		return nil
+	} else if sub := profile.String("sub"); sub != idToken.Subject {
+		return fmt.Errorf("%w: %s", ErrSubjectMismatch, sub)
+	}
+	return nil
+}
+
+// verifyTokenResponse verifies the ID token included in the token response when the provider
+// supports OpenID Connect.  It returns a nil token for providers that do not.  The issuer and
+// client ID expected are those of the provider.
+func verifyTokenResponse(ctx context.Context, provider Provider, keySets *keySetCache,
+	conf oauth2.Config, token *oauth2.Token, expect idTokenExpectation) (*IDToken, error) {
+	ep := provider.Endpoints()
+	if !ep.SupportsOIDC() {
+		return nil, nil
+	}
+
+	raw, _ := token.Extra("id_token").(string)
+	if raw == "" {
+		return nil, ErrIDTokenMissing
+	}
+
+	expect.Issuer, expect.IssuerAliases, expect.ClientID = ep.Issuer, ep.IssuerAliases,
+		conf.ClientID
+	idToken, err := verifyIDToken(ctx, keySets.get(ep.JWKSURL), raw, expect)
 	if err != nil {
-		return nil, fmt.Errorf("authentication exchance failed: %w", err)
+		return nil, fmt.Errorf("failed to verify id token: %w", err)
 	}
+	return idToken, nil
+}
 
-	client := conf.Client(r.Context(), token)
-	preq, err := client.Get(sa.provider.Endpoints().ProfileURL)
+func fetchProfile(client *http.Client, profileURL string) (ProfileMap, []byte, error) {
+	preq, err := client.Get(profileURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch profile: %w", err)
+		return nil, nil, fmt.Errorf("failed to fetch profile: %w", err)
 	}
 
 	defer func() {
@@ -68,22 +275,13 @@ func (sa *authenticator) Complete(w http.ResponseWriter, r *http.Request) (
 
 	profileRaw, err := io.ReadAll(preq.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read profile: %w", err)
+		return nil, nil, fmt.Errorf("failed to read profile: %w", err)
 	}
 
 	profileMap := map[string]interface{}{}
 	if err := json.Unmarshal(profileRaw, &profileMap); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal profile: %w", err)
+		return nil, nil, fmt.Errorf("failed to unmarshal profile: %w", err)
 	}
 
-	profile, err := sa.provider.ExtractProfile(profileMap, profileRaw)
-	if err != nil {
-		return nil, fmt.Errorf("failed to extract profile: %w", err)
-	}
-
-	return &AuthResult{
-		Provider:    sa.provider.Name(),
-		Profile:     profile,
-		Token:       *token,
-		RedirectURL: session.RedirectURL}, nil
+	return profileMap, profileRaw, nil
 }
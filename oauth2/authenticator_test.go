@@ -0,0 +1,54 @@
+package oauth2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/midsbie/authagon/store"
+	"golang.org/x/oauth2"
+)
+
+// minimalProvider implements Provider alone, as external implementations may.
+type minimalProvider struct{}
+
+func (minimalProvider) Name() string { return "minimal" }
+
+func (minimalProvider) Configure(conf *ServiceConfig) oauth2.Config {
+	return oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{
+		AuthURL: "https://provider.example.com/authorize"}}
+}
+
+func (minimalProvider) Endpoints() endpoints { return endpoints{} }
+
+func (minimalProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
+	return Profile{}, nil
+}
+
+func TestStartWithoutAuthCodeOptioner(t *testing.T) {
+	sm, err := NewJWTSessionManager(store.NewCookieStore(), "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	svc := NewService(ServiceConfig{BaseURL: "http://example.com", SessionManager: sm})
+	svc.Register(minimalProvider{})
+	auth, err := svc.NewAuthenticator("minimal")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/login", nil)
+	if err := auth.Start(w, r, AuthConfig{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid location: %v", err)
+	} else if loc.Host != "provider.example.com" || loc.Query().Get("state") == "" {
+		t.Errorf("unexpected location: %s", loc)
+	}
+}
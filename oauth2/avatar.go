@@ -0,0 +1,70 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxAvatarSize is the largest avatar, in bytes, that is fetched from a provider.
+const maxAvatarSize = 4 << 20
+
+// AvatarSink stores the avatar of a user, as fetched from a provider that serves it as binary data
+// rather than by URL, and returns the URL the avatar can be retrieved from.  Applications may, for
+// instance, write avatars to blob storage.
+type AvatarSink interface {
+	StoreAvatar(ctx context.Context, profile Profile, contentType string, data []byte) (
+		string, error)
+}
+
+// AvatarSinkFunc adapts a function to an AvatarSink.
+type AvatarSinkFunc func(ctx context.Context, profile Profile, contentType string,
+	data []byte) (string, error)
+
+func (f AvatarSinkFunc) StoreAvatar(ctx context.Context, profile Profile, contentType string,
+	data []byte) (string, error) {
+	return f(ctx, profile, contentType, data)
+}
+
+// DataURLAvatarSink embeds avatars in the profile as data URLs.
+var DataURLAvatarSink AvatarSink = AvatarSinkFunc(func(_ context.Context, _ Profile,
+	contentType string, data []byte) (string, error) {
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+})
+
+// fetchAvatar fetches the avatar served at url and stores it in sink.  It returns an empty URL if
+// the user has no avatar.
+func fetchAvatar(ctx context.Context, client *http.Client, url string, sink AvatarSink,
+	profile Profile) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch avatar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	} else if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch avatar: unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read avatar: %w", err)
+	} else if len(data) > maxAvatarSize {
+		return "", fmt.Errorf("avatar exceeds %d bytes", maxAvatarSize)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return sink.StoreAvatar(ctx, profile, contentType, data)
+}
@@ -0,0 +1,321 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ Provider         = (*definedProvider)(nil)
+	_ AuthCodeOptioner = (*definedProvider)(nil)
+
+	claimTemplatePattern = regexp.MustCompile(`\{([^{}]+)\}`)
+)
+
+// ProviderDefinitions is the document read by LoadProviders.
+type ProviderDefinitions struct {
+	Providers []ProviderDefinition `yaml:"providers"`
+}
+
+// ProviderDefinition declares a provider without requiring a dedicated Go type.  The endpoints are
+// either given explicitly or, when only Issuer is set, discovered from the issuer's OpenID Connect
+// configuration.  Explicit endpoints that include JWKSURL must be accompanied by Issuer, against
+// which the ID tokens are validated.  Client credentials may be read from the environment variables
+// named by ClientIDEnv and ClientSecretEnv so that they need not be stored along with the
+// definition, in which case the variables must be set and not empty.
+type ProviderDefinition struct {
+	Name            string `yaml:"name"`
+	ClientID        string `yaml:"client_id"`
+	ClientIDEnv     string `yaml:"client_id_env"`
+	ClientSecret    string `yaml:"client_secret"`
+	ClientSecretEnv string `yaml:"client_secret_env"`
+	CallbackURL     string `yaml:"callback_url"`
+
+	Issuer        string `yaml:"issuer"`
+	AuthURL       string `yaml:"auth_url"`
+	TokenURL      string `yaml:"token_url"`
+	DeviceAuthURL string `yaml:"device_auth_url"`
+	ProfileURL    string `yaml:"profile_url"`
+	JWKSURL       string `yaml:"jwks_url"`
+	RevocationURL string `yaml:"revocation_url"`
+	// AuthStyle is how the client authenticates to the token endpoint: "header" or "params".
+	// It is detected automatically when empty.
+	AuthStyle string `yaml:"auth_style"`
+
+	Scopes       []string          `yaml:"scopes"`
+	AuthParams   map[string]string `yaml:"auth_params"`
+	ResponseMode string            `yaml:"response_mode"`
+
+	Profile ClaimMapping `yaml:"profile"`
+}
+
+// ClaimMapping maps the fields of a provider's profile payload, or of its ID token when it has no
+// profile URL, to Profile fields.  Each mapping is a dot-separated path into the payload, such as
+// "data.attributes.email", where numeric segments index into arrays.  A mapping may also be a
+// template in which paths are enclosed in braces, such as
+// "https://cdn.example.com/avatars/{id}/{avatar}.png".
+//
+// EmailVerified is a path to a boolean field reporting whether the email is verified.  Emails are
+// considered unverified when it is not set.  Only the fields listed in Attributes are copied to the
+// profile's attributes, keyed by path.
+type ClaimMapping struct {
+	ID            string   `yaml:"id"`
+	Name          string   `yaml:"name"`
+	FirstName     string   `yaml:"first_name"`
+	LastName      string   `yaml:"last_name"`
+	Email         string   `yaml:"email"`
+	EmailVerified string   `yaml:"email_verified"`
+	PictureURL    string   `yaml:"picture_url"`
+	Attributes    []string `yaml:"attributes"`
+}
+
+// LoadProviders reads provider definitions in YAML or JSON form and returns the corresponding
+// providers, ready to be registered with OAuth2Service.Register.  For example:
+//
+//	providers:
+//	  - name: discord
+//	    client_id_env: DISCORD_CLIENT_ID
+//	    client_secret_env: DISCORD_CLIENT_SECRET
+//	    auth_url: https://discord.com/oauth2/authorize
+//	    token_url: https://discord.com/api/oauth2/token
+//	    profile_url: https://discord.com/api/users/@me
+//	    scopes: [identify, email]
+//	    profile:
+//	      id: id
+//	      name: global_name
+//	      email: email
+//	      picture_url: https://cdn.discordapp.com/avatars/{id}/{avatar}.png
+//	      attributes: [username, verified]
+//
+// Endpoints are discovered, for definitions that require it, with the HTTP client carried by ctx
+// under the oauth2.HTTPClient key, if any.
+func LoadProviders(ctx context.Context, r io.Reader) ([]Provider, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	var defs ProviderDefinitions
+	if err := dec.Decode(&defs); err != nil {
+		return nil, fmt.Errorf("failed to decode provider definitions: %w", err)
+	}
+
+	names := map[string]bool{}
+	providers := make([]Provider, 0, len(defs.Providers))
+	for _, def := range defs.Providers {
+		if names[def.Name] {
+			return nil, fmt.Errorf("duplicate provider definition: %s", def.Name)
+		}
+		names[def.Name] = true
+
+		p, err := NewDefinedProvider(ctx, def)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+
+	return providers, nil
+}
+
+type definedProvider struct {
+	StandardProvider
+	authParams map[string]string
+	mapping    ClaimMapping
+}
+
+// NewDefinedProvider creates a provider from a definition.  See LoadProviders.
+func NewDefinedProvider(ctx context.Context, def ProviderDefinition) (*definedProvider, error) {
+	if def.Name == "" {
+		return nil, fmt.Errorf("provider name is required")
+	}
+
+	clientID, clientSecret, err := def.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("invalid provider definition %s: %w", def.Name, err)
+	}
+
+	ep, err := def.endpoints(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provider definition %s: %w", def.Name, err)
+	}
+
+	mapping := def.Profile
+	if mapping.ID == "" {
+		mapping.ID = "id"
+		if ep.SupportsOIDC() {
+			mapping.ID = "sub"
+		}
+	}
+
+	// Only discovered endpoints are known to support OpenID Connect's offline_access scope.
+	offlineStyle := offlineAccessNone
+	if def.discovered() {
+		offlineStyle = offlineAccessScope
+	}
+
+	options := []StandardProviderOption{WithResponseMode(def.ResponseMode)}
+	if def.CallbackURL != "" {
+		options = append(options, WithCallbackURL(def.CallbackURL))
+	}
+
+	return &definedProvider{
+		StandardProvider: StandardProvider{
+			name:         def.Name,
+			endpoints:    ep,
+			scopes:       def.Scopes,
+			offlineStyle: offlineStyle,
+			config:       NewProviderConfig(clientID, clientSecret, options),
+		},
+		authParams: def.AuthParams,
+		mapping:    mapping,
+	}, nil
+}
+
+// credentials returns the client ID and secret of the definition, reading them from the
+// environment when so configured.
+func (def ProviderDefinition) credentials() (string, string, error) {
+	clientID, clientSecret := def.ClientID, def.ClientSecret
+	var err error
+	if def.ClientIDEnv != "" {
+		if clientID, err = lookupEnv(def.ClientIDEnv); err != nil {
+			return "", "", err
+		}
+	}
+	if def.ClientSecretEnv != "" {
+		if clientSecret, err = lookupEnv(def.ClientSecretEnv); err != nil {
+			return "", "", err
+		}
+	}
+	return clientID, clientSecret, nil
+}
+
+func lookupEnv(name string) (string, error) {
+	if v, ok := os.LookupEnv(name); ok && v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("environment variable %s is not set", name)
+}
+
+// discovered returns whether the endpoints are discovered from the issuer's configuration.
+func (def ProviderDefinition) discovered() bool {
+	return def.AuthURL == "" && def.Issuer != ""
+}
+
+func (def ProviderDefinition) endpoints(ctx context.Context) (endpoints, error) {
+	if def.discovered() {
+		return discover(ctx, def.Issuer)
+	}
+
+	var authStyle oauth2.AuthStyle
+	switch def.AuthStyle {
+	case "":
+		authStyle = oauth2.AuthStyleAutoDetect
+	case "header":
+		authStyle = oauth2.AuthStyleInHeader
+	case "params":
+		authStyle = oauth2.AuthStyleInParams
+	default:
+		return endpoints{}, fmt.Errorf("invalid auth style: %s", def.AuthStyle)
+	}
+
+	switch {
+	case def.AuthURL == "":
+		return endpoints{}, fmt.Errorf("auth url is required")
+	case def.TokenURL == "":
+		return endpoints{}, fmt.Errorf("token url is required")
+	case def.ProfileURL == "" && def.JWKSURL == "":
+		return endpoints{}, fmt.Errorf("either a profile url or a jwks url is required")
+	case def.JWKSURL != "" && def.Issuer == "":
+		// The issuer is required to validate the ID tokens signed with the key set.
+		return endpoints{}, fmt.Errorf("issuer is required along with a jwks url")
+	}
+
+	return endpoints{
+		OAuth2: oauth2.Endpoint{
+			AuthURL:       def.AuthURL,
+			DeviceAuthURL: def.DeviceAuthURL,
+			TokenURL:      def.TokenURL,
+			AuthStyle:     authStyle,
+		},
+		ProfileURL:    def.ProfileURL,
+		Issuer:        def.Issuer,
+		JWKSURL:       def.JWKSURL,
+		RevocationURL: def.RevocationURL,
+	}, nil
+}
+
+func (p *definedProvider) AuthCodeOptions() []oauth2.AuthCodeOption {
+	opts := p.StandardProvider.AuthCodeOptions()
+	for k, v := range p.authParams {
+		if !reservedAuthParams[k] {
+			opts = append(opts, oauth2.SetAuthURLParam(k, v))
+		}
+	}
+	return opts
+}
+
+func (p *definedProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
+	canonicalId := data.Lookup(p.mapping.ID)
+	if canonicalId == "" {
+		return Profile{}, fmt.Errorf("profile field missing: %s", p.mapping.ID)
+	}
+
+	id, err := HashID(p.name + "_" + canonicalId)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	profile := Profile{
+		ID:          id,
+		CanonicalID: canonicalId,
+		Name:        mapClaim(data, p.mapping.Name),
+		FirstName:   mapClaim(data, p.mapping.FirstName),
+		LastName:    mapClaim(data, p.mapping.LastName),
+		Email:       mapClaim(data, p.mapping.Email),
+		PictureURL:  mapClaim(data, p.mapping.PictureURL),
+	}
+
+	if p.mapping.EmailVerified != "" {
+		verified, _ := strconv.ParseBool(data.Lookup(p.mapping.EmailVerified))
+		profile.EmailVerified = verified
+	}
+
+	for _, path := range p.mapping.Attributes {
+		if v, ok := data.LookupValue(path); ok {
+			if profile.Attributes == nil {
+				profile.Attributes = map[string]interface{}{}
+			}
+			profile.Attributes[path] = v
+		}
+	}
+
+	return profile, nil
+}
+
+// mapClaim resolves a claim mapping, which is either a path or a template enclosing paths in
+// braces.  A template resolves to an empty string if any of its paths is not found.
+func mapClaim(data ProfileMap, mapping string) string {
+	if mapping == "" {
+		return ""
+	} else if !strings.Contains(mapping, "{") {
+		return data.Lookup(mapping)
+	}
+
+	missing := false
+	s := claimTemplatePattern.ReplaceAllStringFunc(mapping, func(m string) string {
+		v := data.Lookup(m[1 : len(m)-1])
+		missing = missing || v == ""
+		return v
+	})
+	if missing {
+		return ""
+	}
+	return s
+}
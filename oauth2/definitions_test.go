@@ -0,0 +1,58 @@
+package oauth2
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLoadProvidersCredentialsFromEnv(t *testing.T) {
+	const doc = `
+providers:
+  - name: example
+    client_id_env: EXAMPLE_CLIENT_ID
+    client_secret_env: EXAMPLE_CLIENT_SECRET
+    auth_url: https://example.com/oauth/authorize
+    token_url: https://example.com/oauth/token
+    profile_url: https://example.com/api/user
+`
+	t.Setenv("EXAMPLE_CLIENT_ID", "client")
+	t.Setenv("EXAMPLE_CLIENT_SECRET", "")
+
+	_, err := LoadProviders(context.Background(), strings.NewReader(doc))
+	if err == nil || !strings.Contains(err.Error(), "EXAMPLE_CLIENT_SECRET") {
+		t.Fatalf("error = %v, want one naming EXAMPLE_CLIENT_SECRET", err)
+	}
+
+	t.Setenv("EXAMPLE_CLIENT_SECRET", "secret")
+	providers, err := LoadProviders(context.Background(), strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	conf := providers[0].Configure(&ServiceConfig{BaseURL: "https://app.example.com"})
+	if conf.ClientID != "client" || conf.ClientSecret != "secret" {
+		t.Errorf("credentials = %q, %q, want %q, %q", conf.ClientID, conf.ClientSecret,
+			"client", "secret")
+	}
+}
+
+func TestLoadProvidersRequiresIssuerWithJWKS(t *testing.T) {
+	const doc = `
+providers:
+  - name: example
+    client_id: client
+    auth_url: https://example.com/oauth/authorize
+    token_url: https://example.com/oauth/token
+    jwks_url: https://example.com/oauth/keys
+`
+	_, err := LoadProviders(context.Background(), strings.NewReader(doc))
+	if err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Fatalf("error = %v, want one requiring an issuer", err)
+	}
+
+	withIssuer := doc + "    issuer: https://example.com\n"
+	if _, err := LoadProviders(context.Background(), strings.NewReader(withIssuer)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package oauth2
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// DeviceAuthenticator authenticates users through the OAuth 2.0 Device Authorization Grant (RFC
+// 8628), which suits clients such as CLI tools and TVs that cannot receive browser redirects.
+//
+// Start requests a device and user code from the provider.  The caller then presents the user code
+// and verification URI to the user, who completes the authorization on another device, while
+// Complete polls the provider until the authorization is granted, denied or expires.
+type DeviceAuthenticator interface {
+	Start(ctx context.Context) (*oauth2.DeviceAuthResponse, error)
+	Complete(ctx context.Context, da *oauth2.DeviceAuthResponse) (*AuthResult, error)
+}
+
+type deviceAuthenticator struct {
+	svcConf  *ServiceConfig
+	provider Provider
+	keySets  *keySetCache
+}
+
+func (da *deviceAuthenticator) Start(ctx context.Context) (*oauth2.DeviceAuthResponse, error) {
+	conf := da.provider.Configure(da.svcConf)
+	resp, err := conf.DeviceAuth(ctx)
+	if err != nil {
+		return nil, wrapProviderError("device authorization request failed", err)
+	}
+	return resp, nil
+}
+
+// Complete polls the token endpoint at the interval requested by the provider, backing off when
+// asked to slow down, until the user grants or denies access or the device code expires.  The
+// polling is also abandoned when ctx is done.
+func (da *deviceAuthenticator) Complete(ctx context.Context, resp *oauth2.DeviceAuthResponse) (
+	*AuthResult, error) {
+	result, err := da.complete(ctx, resp)
+	if err != nil {
+		da.svcConf.Hooks.loginFailure(ctx, da.provider.Name(), err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (da *deviceAuthenticator) complete(ctx context.Context, resp *oauth2.DeviceAuthResponse) (
+	*AuthResult, error) {
+	conf := da.provider.Configure(da.svcConf)
+	token, err := conf.DeviceAccessToken(ctx, resp)
+	if err != nil {
+		return nil, wrapProviderError("device access token request failed", err)
+	}
+
+	// No nonce is involved in the device flow; the ID token is otherwise verified as usual.
+	result, err := buildAuthResult(ctx, da.provider, da.keySets, conf, token,
+		idTokenExpectation{}, nil)
+	if err != nil {
+		return nil, err
+	} else if err := finishAuthResult(ctx, da.svcConf, result, ""); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
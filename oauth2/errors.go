@@ -1,10 +1,135 @@
 package oauth2
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
 
 var (
 	ErrNoProvider      = errors.New("no provider given")
+	ErrUnknownProvider = errors.New("invalid provider name specified")
 	ErrStateMissing    = errors.New("state missing")
 	ErrUnexpectedState = errors.New("unexpected state")
+	ErrCodeMissing     = errors.New("code missing")
 	ErrUnauthenticated = errors.New("not authenticated")
+	ErrIDTokenMissing  = errors.New("id token missing")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+	ErrSubjectMismatch = errors.New("profile subject does not match id token")
+	ErrTokenRefresh    = errors.New("token refresh failed")
+
+	ErrMembershipRequired = errors.New("user is not a member of an allowed organization")
+	ErrTenantNotAllowed   = errors.New("tenant not allowed")
+
+	ErrHostedDomainNotAllowed = errors.New("hosted domain not allowed")
+	ErrEmailNotVerified       = errors.New("email not verified")
+
+	ErrNoIdentityStore = errors.New("no identity store configured")
+	ErrIdentityLinked  = errors.New("identity is linked to another user")
+	ErrLastIdentity    = errors.New("cannot unlink the last identity of a user")
+
+	ErrRevocationUnsupported = errors.New("token revocation not supported by provider")
+	ErrDeviceFlowUnsupported = errors.New("device authorization not supported by provider")
+)
+
+// Error codes defined by RFC 6749 and OpenID Connect that providers report through ProviderError.
+const (
+	ErrorCodeAccessDenied             = "access_denied"
+	ErrorCodeInvalidRequest           = "invalid_request"
+	ErrorCodeInvalidGrant             = "invalid_grant"
+	ErrorCodeInvalidScope             = "invalid_scope"
+	ErrorCodeServerError              = "server_error"
+	ErrorCodeTemporarilyUnavailable   = "temporarily_unavailable"
+	ErrorCodeInteractionRequired      = "interaction_required"
+	ErrorCodeLoginRequired            = "login_required"
+	ErrorCodeConsentRequired          = "consent_required"
+	ErrorCodeAccountSelectionRequired = "account_selection_required"
+	ErrorCodeExpiredToken             = "expired_token"
+	ErrorCodeInvalidToken             = "invalid_token"
 )
+
+// ProviderError is an error reported by a provider, either through the error parameters of the
+// authorization callback or in the response of its token or revocation endpoints.  Errors of the
+// token endpoint hold the underlying *oauth2.RetrieveError in Err.
+type ProviderError struct {
+	Code        string // RFC 6749 error code, e.g. "access_denied"
+	Description string
+	URI         string
+	Err         error
+}
+
+func (e *ProviderError) Error() string {
+	s := "provider error: " + e.Code
+	if e.Description != "" {
+		s += ": " + e.Description
+	}
+	return s
+}
+
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+// IsAccessDenied reports whether err is caused by the user or the provider denying the
+// authorization request, as happens when the user cancels the consent screen.
+func IsAccessDenied(err error) bool {
+	return hasProviderErrorCode(err, ErrorCodeAccessDenied)
+}
+
+// IsInteractionRequired reports whether err is caused by the provider requiring user interaction,
+// typically in response to a request made with prompt=none.
+func IsInteractionRequired(err error) bool {
+	return hasProviderErrorCode(err, ErrorCodeInteractionRequired, ErrorCodeLoginRequired,
+		ErrorCodeConsentRequired, ErrorCodeAccountSelectionRequired)
+}
+
+// IsInvalidGrant reports whether err is caused by the provider rejecting an authorization code or
+// refresh token as invalid, expired or revoked.
+func IsInvalidGrant(err error) bool {
+	return hasProviderErrorCode(err, ErrorCodeInvalidGrant)
+}
+
+func hasProviderErrorCode(err error, codes ...string) bool {
+	var perr *ProviderError
+	if !errors.As(err, &perr) {
+		return false
+	}
+	return containsString(codes, perr.Code)
+}
+
+// callbackError returns the error reported in the parameters of an authorization callback, or nil
+// if the callback carries no error.
+func callbackError(params url.Values) error {
+	code := params.Get("error")
+	if code == "" {
+		return nil
+	}
+
+	return &ProviderError{
+		Code:        code,
+		Description: params.Get("error_description"),
+		URI:         params.Get("error_uri"),
+	}
+}
+
+// asProviderError converts an *oauth2.RetrieveError carrying an error code into a ProviderError,
+// and returns any other error unchanged.
+func asProviderError(err error) error {
+	var rerr *oauth2.RetrieveError
+	if !errors.As(err, &rerr) || rerr.ErrorCode == "" {
+		return err
+	}
+
+	return &ProviderError{
+		Code:        rerr.ErrorCode,
+		Description: rerr.ErrorDescription,
+		URI:         rerr.ErrorURI,
+		Err:         err,
+	}
+}
+
+// wrapProviderError is like fmt.Errorf("<msg>: %w", err) where err is first converted by
+// asProviderError.
+func wrapProviderError(msg string, err error) error {
+	return fmt.Errorf("%s: %w", msg, asProviderError(err))
+}
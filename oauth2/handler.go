@@ -0,0 +1,254 @@
+package oauth2
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultLoginPathTemplate = "/u/auth/" + ProviderPlaceholder
+	DefaultLogoutPath        = "/u/logout"
+	defaultRedirectParam     = "redirect_to"
+)
+
+// SuccessRenderer responds to a request whose authentication completed and for which a session
+// was created.
+type SuccessRenderer func(w http.ResponseWriter, r *http.Request, result *AuthResult)
+
+// ErrorRenderer responds to a request that failed to be handled.
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, err error)
+
+// handlerOption is the type for functional options.
+type handlerOption func(*handler)
+
+// WithLoginPath sets the path template of the route that starts authentications, which must
+// include ProviderPlaceholder.  DefaultLoginPathTemplate is used by default.
+func WithLoginPath(template string) handlerOption {
+	return func(h *handler) {
+		h.loginPath = template
+	}
+}
+
+// WithLogoutPath sets the path of the route that logs users out.  DefaultLogoutPath is used by
+// default.
+func WithLogoutPath(path string) handlerOption {
+	return func(h *handler) {
+		h.logoutPath = path
+	}
+}
+
+// WithLogoutRedirect sets where users are redirected once logged out.  It defaults to "/".
+func WithLogoutRedirect(redirectURL string) handlerOption {
+	return func(h *handler) {
+		h.logoutRedirect = redirectURL
+	}
+}
+
+// WithAuthConfig sets the function that configures the authentications started by the handler.
+// By default, users are redirected to the URL given in the redirect_to query parameter once
+// authenticated, provided the service's RedirectPolicy allows it.
+func WithAuthConfig(fn func(r *http.Request) AuthConfig) handlerOption {
+	return func(h *handler) {
+		h.authConfig = fn
+	}
+}
+
+// WithSuccessRenderer sets how completed authentications are responded to.  By default, users are
+// redirected to the AuthResult's RedirectURL, or to "/" in its absence.
+func WithSuccessRenderer(fn SuccessRenderer) handlerOption {
+	return func(h *handler) {
+		h.renderSuccess = fn
+	}
+}
+
+// WithErrorRenderer sets how errors are responded to.  By default, a plain text response is written
+// with the status given by ErrorStatus.
+func WithErrorRenderer(fn ErrorRenderer) handlerOption {
+	return func(h *handler) {
+		h.renderError = fn
+	}
+}
+
+type handler struct {
+	svc            *OAuth2Service
+	sessionCtl     *SessionCtl
+	hooks          *Hooks
+	loginPath      string
+	logoutPath     string
+	logoutRedirect string
+	authConfig     func(r *http.Request) AuthConfig
+	renderSuccess  SuccessRenderer
+	renderError    ErrorRenderer
+}
+
+// Handler returns an http.Handler serving the routes of the authentication flow: the login route,
+// which redirects users to the provider named in its path, the callback route, derived from the
+// service's CallbackPathTemplate, which creates a session through sessionCtl, and the logout route.
+// Since logging out also revokes the user's tokens, the logout route only accepts POST requests
+// and rejects those a browser reports as originating from another site.  Requests are matched
+// against the full URL path, so that the handler may be mounted under any router, for instance:
+//
+//	mux.Handle("/u/", svc.Handler(sessionCtl))
+//
+// Other requests are responded to with 404 Not Found.  Sessions created and deleted by the handler
+// invoke the service's hooks, whether or not sessionCtl is associated with it through WithService.
+func (s *OAuth2Service) Handler(sessionCtl *SessionCtl, options ...handlerOption) http.Handler {
+	h := &handler{
+		svc:            s,
+		sessionCtl:     sessionCtl,
+		hooks:          &s.config.Hooks,
+		loginPath:      DefaultLoginPathTemplate,
+		logoutPath:     DefaultLogoutPath,
+		logoutRedirect: "/",
+		authConfig:     defaultAuthConfig,
+		renderSuccess:  renderRedirect,
+		renderError:    renderErrorStatus}
+
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if path == h.logoutPath {
+		if !allowMethods(w, r, http.MethodPost) {
+			return
+		} else if !sameOrigin(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		h.logout(w, r)
+	} else if name, ok := matchProviderPath(h.svc.config.CallbackPathTemplate, path); ok {
+		// Providers configured with response_mode=form_post post the callback instead.
+		if allowMethods(w, r, http.MethodGet, http.MethodPost) {
+			h.callback(w, r, name)
+		}
+	} else if name, ok := matchProviderPath(h.loginPath, path); ok {
+		if allowMethods(w, r, http.MethodGet) {
+			h.login(w, r, name)
+		}
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// allowMethods returns whether the request's method is one of those given, responding with 405
+// Method Not Allowed otherwise.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	if containsString(methods, r.Method) {
+		return true
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+func (h *handler) login(w http.ResponseWriter, r *http.Request, name string) {
+	auth, err := h.svc.NewAuthenticator(name)
+	if err != nil {
+		h.renderError(w, r, err)
+	} else if err := auth.Start(w, r, h.authConfig(r)); err != nil {
+		h.renderError(w, r, err)
+	}
+}
+
+func (h *handler) callback(w http.ResponseWriter, r *http.Request, name string) {
+	auth, err := h.svc.NewAuthenticator(name)
+	if err != nil {
+		h.renderError(w, r, err)
+		return
+	}
+
+	result, err := auth.Complete(w, r)
+	if err != nil {
+		h.renderError(w, r, err)
+	} else if _, err := h.sessionCtl.create(r.Context(), w, result, h.hooks); err != nil {
+		h.renderError(w, r, err)
+	} else {
+		h.renderSuccess(w, r, result)
+	}
+}
+
+func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
+	err := h.sessionCtl.logout(r.Context(), w, r, h.svc, h.hooks)
+	if err != nil && !errors.Is(err, ErrUnauthenticated) {
+		h.renderError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, h.logoutRedirect, http.StatusSeeOther)
+}
+
+// sameOrigin returns whether the request originates from the same origin, as reported by the
+// browser through the Sec-Fetch-Site or, failing that, the Origin header.  Requests carrying
+// neither, such as those of non-browser clients, are assumed to be.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// matchProviderPath matches the path against a template including ProviderPlaceholder, returning
+// the provider name it holds.
+func matchProviderPath(template, path string) (string, bool) {
+	prefix, suffix, ok := strings.Cut(template, ProviderPlaceholder)
+	if !ok || !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) ||
+		len(path) <= len(prefix)+len(suffix) {
+		return "", false
+	}
+
+	name := path[len(prefix) : len(path)-len(suffix)]
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+func defaultAuthConfig(r *http.Request) AuthConfig {
+	return AuthConfig{RedirectURL: r.URL.Query().Get(defaultRedirectParam)}
+}
+
+func renderRedirect(w http.ResponseWriter, r *http.Request, result *AuthResult) {
+	redirectURL := result.RedirectURL
+	if redirectURL == "" {
+		redirectURL = "/"
+	}
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+func renderErrorStatus(w http.ResponseWriter, r *http.Request, err error) {
+	status := ErrorStatus(err)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// ErrorStatus returns the HTTP status suited to respond to a request that failed with err: 404 Not
+// Found for unknown providers, 403 Forbidden when the user denied access or is not allowed to log
+// in, 400 Bad Request for invalid callbacks, and 500 Internal Server Error otherwise.
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNoProvider), errors.Is(err, ErrUnknownProvider):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case IsAccessDenied(err), errors.Is(err, ErrMembershipRequired),
+		errors.Is(err, ErrTenantNotAllowed), errors.Is(err, ErrHostedDomainNotAllowed),
+		errors.Is(err, ErrEmailNotVerified), errors.Is(err, ErrIdentityLinked):
+		return http.StatusForbidden
+	case errors.Is(err, ErrStateMissing), errors.Is(err, ErrUnexpectedState),
+		errors.Is(err, ErrCodeMissing):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,81 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/midsbie/authagon/store"
+)
+
+func TestHandlerLogout(t *testing.T) {
+	svc := NewService(ServiceConfig{})
+	h := svc.Handler(NewSessionCtl(store.NewCookieStore(), store.NewMemoryStore()))
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"get", http.MethodGet, nil, http.StatusMethodNotAllowed},
+		{"post", http.MethodPost, nil, http.StatusSeeOther},
+		{"same origin", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin"},
+			http.StatusSeeOther},
+		{"cross site", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site"},
+			http.StatusForbidden},
+		{"same site", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-site"},
+			http.StatusForbidden},
+		{"matching origin", http.MethodPost, map[string]string{"Origin": "http://example.com"},
+			http.StatusSeeOther},
+		{"other origin", http.MethodPost, map[string]string{"Origin": "https://evil.com"},
+			http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://example.com"+DefaultLogoutPath, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerInvokesServiceHooks(t *testing.T) {
+	var loggedOut []string
+	svc := NewService(ServiceConfig{Hooks: Hooks{
+		OnLogout: func(ctx context.Context, sid string, result *AuthResult) {
+			loggedOut = append(loggedOut, result.Provider)
+		},
+	}})
+	svc.Register(&testProvider{StandardProvider{name: "test"}})
+
+	sessionCtl := NewSessionCtl(store.NewCookieStore(), store.NewMemoryStore())
+	h := svc.Handler(sessionCtl)
+	if sessionCtl.hooks != nil {
+		t.Error("session controller modified by Handler")
+	}
+
+	w := httptest.NewRecorder()
+	if _, err := sessionCtl.Set(context.Background(), w, AuthResult{Provider: "test"}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, DefaultLogoutPath, nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(loggedOut) != 1 || loggedOut[0] != "test" {
+		t.Errorf("OnLogout invoked for %v, want [test]", loggedOut)
+	}
+}
@@ -0,0 +1,51 @@
+package oauth2
+
+import (
+	"context"
+)
+
+// Hooks are functions invoked at the steps of the authentication flow, allowing applications to
+// observe them, for instance for auditing, or to veto them.  Any of them may be nil.  Hooks are
+// set in ServiceConfig, and also invoked by the service's handler and by the session controllers
+// associated with the service through WithService.
+type Hooks struct {
+	// OnLoginStart is invoked before the user is redirected to the provider.  It may adjust the
+	// configuration of the authentication, or abort it by returning an error.
+	OnLoginStart func(ctx context.Context, provider string, config *AuthConfig) error
+	// OnLoginSuccess is invoked once the user has authenticated, before the result is returned
+	// from Complete and the session is persisted.  It may modify the result, or reject the login
+	// by returning an error, for instance if the user is banned.
+	OnLoginSuccess func(ctx context.Context, result *AuthResult) error
+	// OnLoginFailure is invoked when an authentication fails to complete, including when it is
+	// rejected by OnLoginSuccess or the session cannot be created.
+	OnLoginFailure func(ctx context.Context, provider string, err error)
+	// OnLogout is invoked when a session is deleted.  The result is that held in the session, or
+	// nil if it could not be retrieved.
+	OnLogout func(ctx context.Context, sid string, result *AuthResult)
+}
+
+func (h *Hooks) loginStart(ctx context.Context, provider string, config *AuthConfig) error {
+	if h == nil || h.OnLoginStart == nil {
+		return nil
+	}
+	return h.OnLoginStart(ctx, provider, config)
+}
+
+func (h *Hooks) loginSuccess(ctx context.Context, result *AuthResult) error {
+	if h == nil || h.OnLoginSuccess == nil {
+		return nil
+	}
+	return h.OnLoginSuccess(ctx, result)
+}
+
+func (h *Hooks) loginFailure(ctx context.Context, provider string, err error) {
+	if h != nil && h.OnLoginFailure != nil {
+		h.OnLoginFailure(ctx, provider, err)
+	}
+}
+
+func (h *Hooks) logout(ctx context.Context, sid string, result *AuthResult) {
+	if h != nil && h.OnLogout != nil {
+		h.OnLogout(ctx, sid, result)
+	}
+}
@@ -0,0 +1,192 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var _ IdentityStore = (*MemoryIdentityStore)(nil)
+
+// Identity identifies a user's account with a provider.
+type Identity struct {
+	Provider    string `json:"provider"`
+	CanonicalID string `json:"canonical_id"`
+}
+
+// Identity returns the provider identity the result authenticates.
+func (a *AuthResult) Identity() Identity {
+	return Identity{Provider: a.Provider, CanonicalID: a.Profile.CanonicalID}
+}
+
+// IdentityStore links provider identities to internal user IDs, allowing a user to log in with
+// any of the providers they have linked to their account.  See ServiceConfig.IdentityStore.
+type IdentityStore interface {
+	// Resolve returns the ID of the user the identity is linked to.  It returns false if the
+	// identity is not linked.
+	Resolve(ctx context.Context, identity Identity) (string, bool, error)
+	// Link links the identity to the user.  Linking an identity to the user it is already linked
+	// to is a no-op, while ErrIdentityLinked is returned if it is linked to another user.
+	Link(ctx context.Context, userID string, identity Identity) error
+	// Unlink removes the link between the identity and the user, if any.
+	Unlink(ctx context.Context, userID string, identity Identity) error
+	// Identities returns the identities linked to the user.
+	Identities(ctx context.Context, userID string) ([]Identity, error)
+}
+
+// resolveUser sets the result's UserID to the user its identity is linked to.  When linkUserID is
+// set, the identity is linked to that user instead, failing with ErrIdentityLinked if it already
+// belongs to another.  Identities seen for the first time are linked to a new user whose ID is the
+// profile's ID.
+func resolveUser(ctx context.Context, identities IdentityStore, result *AuthResult,
+	linkUserID string) error {
+	identity := result.Identity()
+	userID, ok, err := identities.Resolve(ctx, identity)
+	if err != nil {
+		return fmt.Errorf("failed to resolve identity: %w", err)
+	}
+
+	if linkUserID != "" {
+		if ok && userID != linkUserID {
+			return ErrIdentityLinked
+		}
+		userID, ok = linkUserID, false
+	} else if !ok {
+		userID = result.Profile.ID
+	}
+
+	if !ok {
+		if err := identities.Link(ctx, userID, identity); err != nil {
+			return fmt.Errorf("failed to link identity: %w", err)
+		}
+	}
+
+	result.UserID = userID
+	return nil
+}
+
+// LinkedIdentities returns the identities linked to the user.
+func (s *OAuth2Service) LinkedIdentities(ctx context.Context, userID string) (
+	[]Identity, error) {
+	if s.config.IdentityStore == nil {
+		return nil, ErrNoIdentityStore
+	}
+	return s.config.IdentityStore.Identities(ctx, userID)
+}
+
+// UnlinkIdentity removes the identity from the user's linked identities, and from the user
+// persisted in the UserStore if one is configured.  ErrLastIdentity is returned if it is the only
+// one left, as the user would then be unable to log in.
+func (s *OAuth2Service) UnlinkIdentity(ctx context.Context, userID string,
+	identity Identity) error {
+	store := s.config.IdentityStore
+	if store == nil {
+		return ErrNoIdentityStore
+	}
+
+	identities, err := store.Identities(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve identities: %w", err)
+	}
+
+	linked := false
+	for _, id := range identities {
+		linked = linked || id == identity
+	}
+	if !linked {
+		return nil
+	} else if len(identities) == 1 {
+		return ErrLastIdentity
+	}
+
+	if err := store.Unlink(ctx, userID, identity); err != nil {
+		return err
+	}
+	return s.unlinkUserIdentity(ctx, userID, identity)
+}
+
+// unlinkUserIdentity removes the identity from the user persisted in the UserStore, if any.
+func (s *OAuth2Service) unlinkUserIdentity(ctx context.Context, userID string,
+	identity Identity) error {
+	users := s.config.UserStore
+	if users == nil {
+		return nil
+	}
+
+	user, ok, err := users.Find(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	} else if !ok || !user.hasIdentity(identity) {
+		return nil
+	}
+
+	identities := make([]Identity, 0, len(user.Identities))
+	for _, id := range user.Identities {
+		if id != identity {
+			identities = append(identities, id)
+		}
+	}
+	user.Identities = identities
+	if err := users.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return nil
+}
+
+// MemoryIdentityStore is an IdentityStore that keeps links in memory.  It is mostly useful for
+// development and testing since links are lost when the process exits.
+type MemoryIdentityStore struct {
+	mu    sync.RWMutex
+	users map[Identity]string
+}
+
+func NewMemoryIdentityStore() *MemoryIdentityStore {
+	return &MemoryIdentityStore{
+		users: map[Identity]string{}}
+}
+
+func (s *MemoryIdentityStore) Resolve(ctx context.Context, identity Identity) (
+	string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, ok := s.users[identity]
+	return userID, ok, nil
+}
+
+func (s *MemoryIdentityStore) Link(ctx context.Context, userID string,
+	identity Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if linked, ok := s.users[identity]; ok && linked != userID {
+		return ErrIdentityLinked
+	}
+	s.users[identity] = userID
+	return nil
+}
+
+func (s *MemoryIdentityStore) Unlink(ctx context.Context, userID string,
+	identity Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.users[identity] == userID {
+		delete(s.users, identity)
+	}
+	return nil
+}
+
+func (s *MemoryIdentityStore) Identities(ctx context.Context, userID string) (
+	[]Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var identities []Identity
+	for identity, linked := range s.users {
+		if linked == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
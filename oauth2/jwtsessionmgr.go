@@ -26,11 +26,18 @@ type Claims struct {
 }
 
 // Context holds information used to maintain and validate state during the OAuth2 authentication
-// process. It includes a state parameter to prevent CSRF attacks and a URL field which can be used
-// to redirect the user after a successful authentication.
+// process. It includes a state parameter to prevent CSRF attacks, the PKCE code verifier that binds
+// the authorization code to this flow, and a URL field which can be used to redirect the user after
+// a successful authentication.  The scopes and maximum authentication age requested, if any, are
+// carried over so that they can be applied when the authentication completes, as is the user the
+// identity is to be linked to.
 type Context struct {
-	State       string `json:"ste"`
-	RedirectURL string `json:"url"`
+	State       string   `json:"ste"`
+	Verifier    string   `json:"vfr,omitempty"`
+	RedirectURL string   `json:"url"`
+	Scopes      []string `json:"scp,omitempty"`
+	MaxAge      int64    `json:"mag,omitempty"`
+	LinkUserID  string   `json:"lnk,omitempty"`
 }
 
 // JWTSessionManager encapsulates configuration and state for managing JWT-based sessions in an
@@ -40,6 +47,7 @@ type Context struct {
 // authentication and state management in web applications.
 type JWTSessionManager struct {
 	store           store.BrowserStorer
+	crossSite       bool
 	secret          string
 	issuer          string
 	audience        string
@@ -86,6 +94,16 @@ func WithTokenDuration(duration time.Duration) option {
 	}
 }
 
+// WithCrossSiteState stores the session such that it is also sent along with cross-site requests.
+// It is required by providers that post the authorization response back (response_mode=form_post),
+// since browsers withhold cookies from cross-site POST requests by default.  The store must
+// implement store.CrossSiteStorer.
+func WithCrossSiteState() option {
+	return func(c *JWTSessionManager) {
+		c.crossSite = true
+	}
+}
+
 // NewJWTSessionManager initializes a new JWTSession with default configuration and applies any
 // provided options for customization. This function creates a session manager designed for
 // JWT-based authentication flows, allowing the caller to specify key parameters such as the token
@@ -117,9 +135,24 @@ func NewJWTSessionManager(store store.BrowserStorer, secret string, options ...o
 		option(&session)
 	}
 
+	if session.crossSite {
+		var err error
+		if session.store, err = crossSiteStore(session.store); err != nil {
+			return nil, err
+		}
+	}
+
 	return &session, nil
 }
 
+func crossSiteStore(bs store.BrowserStorer) (store.BrowserStorer, error) {
+	css, ok := bs.(store.CrossSiteStorer)
+	if !ok {
+		return nil, fmt.Errorf("store does not support cross-site state")
+	}
+	return css.CrossSite(), nil
+}
+
 func (s *JWTSessionManager) Set(w http.ResponseWriter, r *http.Request, config AuthConfig) (
 	AuthState, error) {
 	state, err := RandomToken(randomTokenLen)
@@ -132,18 +165,31 @@ func (s *JWTSessionManager) Set(w http.ResponseWriter, r *http.Request, config A
 		return AuthState{}, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
+	verifier, err := RandomToken(randomTokenLen)
+	if err != nil {
+		return AuthState{}, fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+
 	auth := AuthState{
 		State:       state,
 		Nonce:       nonce,
+		Verifier:    verifier,
 		Audience:    s.audience,
 		RedirectURL: config.RedirectURL,
+		Scopes:      config.Scopes,
+		MaxAge:      config.MaxAge,
+		LinkUserID:  config.LinkUserID,
 	}
 
 	now := time.Now()
 	claims := Claims{
 		Context: &Context{
 			State:       auth.State,
+			Verifier:    auth.Verifier,
 			RedirectURL: auth.RedirectURL,
+			Scopes:      auth.Scopes,
+			MaxAge:      int64(auth.MaxAge / time.Second),
+			LinkUserID:  auth.LinkUserID,
 		},
 		StandardClaims: jwt.StandardClaims{
 			Id:        auth.Nonce,
@@ -201,8 +247,12 @@ func (s *JWTSessionManager) Get(r *http.Request) (AuthState, error) {
 	return AuthState{
 		State:       claims.Context.State,
 		Nonce:       claims.Id,
+		Verifier:    claims.Context.Verifier,
 		Audience:    claims.Audience,
-		RedirectURL: claims.Context.RedirectURL}, nil
+		RedirectURL: claims.Context.RedirectURL,
+		Scopes:      claims.Context.Scopes,
+		MaxAge:      time.Duration(claims.Context.MaxAge) * time.Second,
+		LinkUserID:  claims.Context.LinkUserID}, nil
 }
 
 func (s *JWTSessionManager) Del(w http.ResponseWriter) error {
@@ -0,0 +1,139 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type sessionContextKey struct{}
+
+// SessionFromContext returns the authentication result held in the session loaded by LoadSession or
+// RequireAuth.  It returns nil if the request is not authenticated.
+func SessionFromContext(ctx context.Context) *AuthResult {
+	if v, ok := ctx.Value(sessionContextKey{}).(AuthSession); ok {
+		return v.Auth()
+	}
+	return nil
+}
+
+// TypedSessionFromContext returns the value of the session loaded by the LoadSession or
+// RequireAuth middleware of a TypedSessionCtl[T].  It returns false if the request is not
+// authenticated.
+func TypedSessionFromContext[T AuthSession](ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(sessionContextKey{}).(T)
+	return v, ok
+}
+
+// requireAuthOption is the type for functional options.
+type requireAuthOption func(*requireAuth)
+
+// WithLoginURL redirects unauthenticated browser requests to the given URL, to which the URL of
+// the request is added as the redirect_to query parameter so that users can be brought back once
+// authenticated.
+func WithLoginURL(loginURL string) requireAuthOption {
+	return func(ra *requireAuth) {
+		ra.loginURL = loginURL
+	}
+}
+
+type requireAuth struct {
+	loginURL string
+}
+
+// LoadSession returns middleware that loads the session associated with the request, if any, and
+// stores it in the request context for SessionFromContext to retrieve.  Unauthenticated requests
+// are let through, the session cookie being deleted if it refers to a session that no longer
+// exists.
+func (s *TypedSessionCtl[T]) LoadSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, ok, err := s.Get(r.Context(), r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		} else if ok {
+			r = r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, v))
+		} else {
+			s.forgetSession(w, r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAuth returns middleware that, like LoadSession, stores the session associated with the
+// request in the request context, but rejects unauthenticated requests.  Requests accepting HTML
+// are redirected to the login URL, if one is configured with WithLoginURL, while others are
+// responded to with 401 Unauthorized and, when they accept JSON, an error object.
+func (s *TypedSessionCtl[T]) RequireAuth(options ...requireAuthOption) func(
+	http.Handler) http.Handler {
+	ra := &requireAuth{}
+	for _, option := range options {
+		option(ra)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			v, ok, err := s.Get(r.Context(), r)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError),
+					http.StatusInternalServerError)
+				return
+			} else if !ok {
+				s.forgetSession(w, r)
+				ra.reject(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), sessionContextKey{}, v)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// forgetSession deletes the session cookie of a request whose session could not be found, as
+// happens once the session expires from the store.
+func (s *TypedSessionCtl[T]) forgetSession(w http.ResponseWriter, r *http.Request) {
+	if _, ok, err := s.GetSessionID(r); err == nil && ok {
+		s.browserStore.Del(w, s.sessionIDKey)
+	}
+}
+
+func (ra *requireAuth) reject(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case ra.loginURL != "" && accepts(r, "text/html"):
+		u, err := url.Parse(ra.loginURL)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+
+		q := u.Query()
+		q.Set(defaultRedirectParam, r.URL.RequestURI())
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	case accepts(r, "application/json"):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": ErrUnauthenticated.Error()})
+	default:
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}
+}
+
+// accepts returns whether the request's Accept header explicitly lists the media type.  Wildcards
+// are disregarded, since nearly all clients send them.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			if mt, _, err := mime.ParseMediaType(part); err == nil && mt == mediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/midsbie/authagon/store"
+)
+
+func TestRequireAuthStaleSession(t *testing.T) {
+	sessions := store.NewMemoryStore()
+	sc := NewSessionCtl(store.NewCookieStore(), sessions)
+
+	w := httptest.NewRecorder()
+	if _, err := sc.Set(context.Background(), w, AuthResult{Provider: "test"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cookies := w.Result().Cookies()
+
+	h := sc.RequireAuth()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if SessionFromContext(r.Context()) == nil {
+			t.Error("session missing from context")
+		}
+	}))
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, requestWithCookies(cookies))
+		return w
+	}
+
+	if w := request(); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Sessions expiring from the store leave their cookie behind.
+	sid, _, _ := sc.GetSessionID(requestWithCookies(cookies))
+	sessions.Del(context.Background(), sid)
+
+	w = request()
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	cleared := false
+	for _, c := range w.Result().Cookies() {
+		cleared = cleared || (c.Name == cookies[0].Name && c.Expires.Before(time.Now()))
+	}
+	if !cleared {
+		t.Error("stale session cookie not deleted")
+	}
+}
+
+func requestWithCookies(cookies []*http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return r
+}
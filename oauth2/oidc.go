@@ -0,0 +1,391 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// TenantIDPlaceholder may appear in a provider's issuer, in which case it is substituted with
+	// the ID token's "tid" claim before the issuer is compared.  Multi-tenant providers such as
+	// Microsoft Entra ID advertise their issuer in this form.
+	TenantIDPlaceholder = "{tenantid}"
+
+	discoveryPath          = "/.well-known/openid-configuration"
+	idTokenLeeway          = time.Minute
+	jwksMaxAge             = time.Hour
+	jwksMinRefreshInterval = time.Minute
+)
+
+var idTokenSigningMethods = []string{
+	jwt.SigningMethodRS256.Alg(), jwt.SigningMethodRS384.Alg(), jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(), jwt.SigningMethodPS384.Alg(), jwt.SigningMethodPS512.Alg(),
+	jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg(),
+}
+
+// discoveryDocument holds the subset of an OpenID Provider's configuration metadata that is used to
+// configure a provider.
+type discoveryDocument struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	DeviceEndpoint        string   `json:"device_authorization_endpoint"`
+	UserInfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	RevocationEndpoint    string   `json:"revocation_endpoint"`
+	EndSessionEndpoint    string   `json:"end_session_endpoint"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// discover fetches the OpenID Provider configuration of the given issuer and returns the endpoints
+// it describes.
+func discover(ctx context.Context, issuerURL string) (endpoints, error) {
+	issuerURL = strings.TrimSuffix(issuerURL, "/")
+
+	var doc discoveryDocument
+	if err := getJSON(ctx, contextClient(ctx), issuerURL+discoveryPath, &doc); err != nil {
+		return endpoints{}, fmt.Errorf("failed to fetch provider configuration: %w", err)
+	}
+
+	switch {
+	case strings.TrimSuffix(doc.Issuer, "/") != issuerURL:
+		return endpoints{}, fmt.Errorf("issuer mismatch: expected %s, got %s",
+			issuerURL, doc.Issuer)
+	case doc.AuthorizationEndpoint == "":
+		return endpoints{}, fmt.Errorf("authorization endpoint missing")
+	case doc.TokenEndpoint == "":
+		return endpoints{}, fmt.Errorf("token endpoint missing")
+	case doc.JWKSURI == "":
+		return endpoints{}, fmt.Errorf("jwks uri missing")
+	}
+
+	authStyle := oauth2.AuthStyleAutoDetect
+	if len(doc.TokenAuthMethods) > 0 && !containsString(doc.TokenAuthMethods,
+		"client_secret_basic") && containsString(doc.TokenAuthMethods, "client_secret_post") {
+		authStyle = oauth2.AuthStyleInParams
+	}
+
+	return endpoints{
+		OAuth2: oauth2.Endpoint{
+			AuthURL:       doc.AuthorizationEndpoint,
+			DeviceAuthURL: doc.DeviceEndpoint,
+			TokenURL:      doc.TokenEndpoint,
+			AuthStyle:     authStyle,
+		},
+		ProfileURL:    doc.UserInfoEndpoint,
+		Issuer:        doc.Issuer,
+		JWKSURL:       doc.JWKSURI,
+		RevocationURL: doc.RevocationEndpoint,
+		EndSessionURL: doc.EndSessionEndpoint,
+	}, nil
+}
+
+// IDToken holds an OpenID Connect ID token whose signature and standard claims have been verified.
+// The registered claims are exposed as fields for convenience, while Claims holds the complete
+// claim set as issued by the provider.
+type IDToken struct {
+	Raw      string
+	Issuer   string
+	Subject  string
+	Audience []string
+	Expiry   time.Time
+	IssuedAt time.Time
+	Nonce    string
+	Claims   ProfileMap
+}
+
+// idTokenExpectation describes the values an ID token's claims are validated against.
+type idTokenExpectation struct {
+	Issuer        string
+	IssuerAliases []string // Further values accepted in the iss claim
+	ClientID      string
+	Nonce         string
+	MaxAge        time.Duration
+}
+
+// verifyIDToken verifies the signature of the raw ID token against the provider's key set and
+// validates its iss, aud, azp, exp, iat, nonce and, when a maximum age is expected, auth_time
+// claims.  Tokens are rejected when no issuer is expected, since their iss claim cannot be checked.
+func verifyIDToken(ctx context.Context, keys *keySet, raw string,
+	expect idTokenExpectation) (*IDToken, error) {
+	if expect.Issuer == "" {
+		return nil, fmt.Errorf("%w: no issuer to validate against", ErrInvalidIDToken)
+	}
+
+	claims := jwt.MapClaims{}
+	parser := jwt.Parser{ValidMethods: idTokenSigningMethods, SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	data := ProfileMap(claims)
+	idt := &IDToken{
+		Raw:      raw,
+		Issuer:   data.String("iss"),
+		Subject:  data.String("sub"),
+		Audience: data.Strings("aud"),
+		Nonce:    data.String("nonce"),
+		Claims:   data,
+	}
+
+	expiry, ok := data.Time("exp")
+	if !ok {
+		return nil, fmt.Errorf("%w: exp claim missing", ErrInvalidIDToken)
+	}
+	idt.Expiry = expiry
+	idt.IssuedAt, _ = data.Time("iat")
+
+	issuer := strings.Replace(expect.Issuer, TenantIDPlaceholder, data.String("tid"), -1)
+	now := time.Now()
+	switch {
+	case idt.Subject == "":
+		return nil, fmt.Errorf("%w: sub claim missing", ErrInvalidIDToken)
+	case idt.Issuer != issuer &&
+		!containsString(expect.IssuerAliases, idt.Issuer):
+		return nil, fmt.Errorf("%w: unexpected issuer: %s", ErrInvalidIDToken, idt.Issuer)
+	case !containsString(idt.Audience, expect.ClientID):
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	case len(idt.Audience) > 1 && data.String("azp") != expect.ClientID:
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+	case now.After(idt.Expiry.Add(idTokenLeeway)):
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	case idt.IssuedAt.After(now.Add(idTokenLeeway)):
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidIDToken)
+	case expect.Nonce != "" && idt.Nonce != expect.Nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	if expect.MaxAge > 0 {
+		authTime, ok := data.Time("auth_time")
+		if !ok {
+			return nil, fmt.Errorf("%w: auth_time claim missing", ErrInvalidIDToken)
+		} else if now.After(authTime.Add(expect.MaxAge + idTokenLeeway)) {
+			return nil, fmt.Errorf("%w: authentication too old", ErrInvalidIDToken)
+		}
+	}
+
+	return idt, nil
+}
+
+// keySetCache holds the signing key sets of every provider, indexed by JWKS URL, so that keys are
+// shared across authenticators rather than fetched on every authentication.
+type keySetCache struct {
+	mu   sync.Mutex
+	sets map[string]*keySet
+}
+
+func newKeySetCache() *keySetCache {
+	return &keySetCache{sets: map[string]*keySet{}}
+}
+
+func (c *keySetCache) get(url string) *keySet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ks, ok := c.sets[url]
+	if !ok {
+		ks = &keySet{url: url}
+		c.sets[url] = ks
+	}
+	return ks
+}
+
+// keySet is a cached JSON Web Key Set.  Keys are refetched once they grow older than jwksMaxAge,
+// or when a token references an unknown key ID as happens after the provider rotates its keys.
+type keySet struct {
+	url       string
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func (ks *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	key, ok := ks.lookup(kid)
+	if ok && now.Sub(ks.fetchedAt) < jwksMaxAge {
+		return key, nil
+	}
+
+	// Refetching is rate limited so that tokens carrying bogus key IDs cannot be used to hammer
+	// the provider's JWKS endpoint.
+	if ks.keys != nil && now.Sub(ks.fetchedAt) < jwksMinRefreshInterval {
+		return nil, fmt.Errorf("signing key not found: %s", kid)
+	}
+
+	keys, err := fetchKeySet(ctx, ks.url)
+	if err != nil {
+		if ok {
+			// Stale keys are preferable to failing outright while the endpoint is unavailable.
+			return key, nil
+		}
+		return nil, err
+	}
+
+	ks.keys, ks.fetchedAt = keys, now
+	if key, ok = ks.lookup(kid); !ok {
+		return nil, fmt.Errorf("signing key not found: %s", kid)
+	}
+	return key, nil
+}
+
+func (ks *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchKeySet(ctx context.Context, url string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, contextClient(ctx), url, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Keys of unsupported types are skipped rather than invalidating the whole set.
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) < 1 {
+		return nil, fmt.Errorf("no usable signing keys found at %s", url)
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key parameter: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// contextClient returns the HTTP client carried by ctx under the oauth2.HTTPClient key, falling
+// back to http.DefaultClient.  This mirrors how golang.org/x/oauth2 selects its client.
+func contextClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && client != nil {
+		return client
+	}
+	return http.DefaultClient
+}
+
+// getJSON issues a GET request to url with the given client and decodes the JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
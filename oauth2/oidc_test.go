@@ -0,0 +1,305 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testClientID = "client"
+)
+
+// testJWKS serves a JSON Web Key Set whose keys can be replaced, counting the requests made.
+type testJWKS struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches int
+	srv     *httptest.Server
+}
+
+func newTestJWKS(t *testing.T, kids ...string) *testJWKS {
+	t.Helper()
+	j := &testJWKS{}
+	j.rotate(t, kids...)
+	j.srv = httptest.NewServer(http.HandlerFunc(j.serve))
+	t.Cleanup(j.srv.Close)
+	return j
+}
+
+func (j *testJWKS) rotate(t *testing.T, kids ...string) {
+	t.Helper()
+	keys := map[string]*rsa.PrivateKey{}
+	for _, kid := range kids {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		keys[kid] = key
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = keys
+}
+
+func (j *testJWKS) serve(w http.ResponseWriter, r *http.Request) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetches++
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, key := range j.keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
+
+func (j *testJWKS) fetchCount() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.fetches
+}
+
+func (j *testJWKS) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	j.mu.Lock()
+	key := j.keys[kid]
+	j.mu.Unlock()
+	return signToken(t, key, kid, claims)
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return raw
+}
+
+func testClaims(overrides jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       testIssuer,
+		"sub":       "subject",
+		"aud":       testClientID,
+		"exp":       now.Add(time.Hour).Unix(),
+		"iat":       now.Unix(),
+		"nonce":     "nonce",
+		"auth_time": now.Add(-time.Minute).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	return claims
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	jwks := newTestJWKS(t, "k1")
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	expect := idTokenExpectation{
+		Issuer:        testIssuer,
+		IssuerAliases: []string{"issuer.example.com"},
+		ClientID:      testClientID,
+		Nonce:         "nonce",
+	}
+	withMaxAge := expect
+	withMaxAge.MaxAge = 10 * time.Minute
+	withoutIssuer := expect
+	withoutIssuer.Issuer = ""
+
+	now := time.Now()
+	tests := []struct {
+		name    string
+		raw     string
+		expect  idTokenExpectation
+		wantErr bool
+	}{
+		{"valid", jwks.sign(t, "k1", testClaims(nil)), expect, false},
+		{"bad signature", signToken(t, other, "k1", testClaims(nil)), expect, true},
+		{"unknown issuer", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"iss": "https://evil.example.com"})), expect, true},
+		{"issuer alias", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"iss": "issuer.example.com"})), expect, false},
+		{"no issuer expected", jwks.sign(t, "k1", testClaims(nil)), withoutIssuer, true},
+		{"other audience", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"aud": "other"})), expect, true},
+		{"several audiences without azp", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"aud": []string{testClientID, "other"}})), expect, true},
+		{"several audiences with other azp", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"aud": []string{testClientID, "other"}, "azp": "other"})), expect, true},
+		{"several audiences with azp", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"aud": []string{testClientID, "other"}, "azp": testClientID})), expect, false},
+		{"expired", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"exp": now.Add(-time.Hour).Unix()})), expect, true},
+		{"expired within leeway", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"exp": now.Add(-idTokenLeeway / 2).Unix()})), expect, false},
+		{"exp missing", jwks.sign(t, "k1", testClaims(jwt.MapClaims{"exp": nil})), expect, true},
+		{"issued in the future", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"iat": now.Add(time.Hour).Unix()})), expect, true},
+		{"sub missing", jwks.sign(t, "k1", testClaims(jwt.MapClaims{"sub": nil})), expect, true},
+		{"nonce mismatch", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"nonce": "other"})), expect, true},
+		{"nonce missing", jwks.sign(t, "k1", testClaims(jwt.MapClaims{"nonce": nil})),
+			expect, true},
+		{"recent authentication", jwks.sign(t, "k1", testClaims(nil)), withMaxAge, false},
+		{"authentication too old", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"auth_time": now.Add(-time.Hour).Unix()})), withMaxAge, true},
+		{"auth_time missing", jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+			"auth_time": nil})), withMaxAge, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := &keySet{url: jwks.srv.URL}
+			idt, err := verifyIDToken(context.Background(), ks, tt.raw, tt.expect)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIDToken) {
+					t.Errorf("error = %v, want ErrInvalidIDToken", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if idt.Subject != "subject" {
+				t.Errorf("subject = %q, want %q", idt.Subject, "subject")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenTenantIssuer(t *testing.T) {
+	jwks := newTestJWKS(t, "k1")
+	expect := idTokenExpectation{
+		Issuer:   "https://login.example.com/" + TenantIDPlaceholder + "/v2.0",
+		ClientID: testClientID,
+	}
+
+	raw := jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+		"iss": "https://login.example.com/tenant/v2.0", "tid": "tenant"}))
+	if _, err := verifyIDToken(context.Background(), &keySet{url: jwks.srv.URL}, raw,
+		expect); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	raw = jwks.sign(t, "k1", testClaims(jwt.MapClaims{
+		"iss": "https://login.example.com/tenant/v2.0", "tid": "other"}))
+	if _, err := verifyIDToken(context.Background(), &keySet{url: jwks.srv.URL}, raw,
+		expect); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("error = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestKeySetRefetchesUnknownKey(t *testing.T) {
+	ctx := context.Background()
+	jwks := newTestJWKS(t, "k1")
+	ks := &keySet{url: jwks.srv.URL}
+
+	if _, err := ks.key(ctx, "k1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := ks.key(ctx, "k1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if jwks.fetchCount() != 1 {
+		t.Fatalf("key set fetched %d times, want 1", jwks.fetchCount())
+	}
+
+	// Keys are not refetched more often than jwksMinRefreshInterval, even for unknown key IDs.
+	jwks.rotate(t, "k2")
+	if _, err := ks.key(ctx, "k2"); err == nil {
+		t.Fatal("unknown key found before the refresh interval elapsed")
+	} else if jwks.fetchCount() != 1 {
+		t.Fatalf("key set fetched %d times, want 1", jwks.fetchCount())
+	}
+
+	ks.fetchedAt = ks.fetchedAt.Add(-jwksMinRefreshInterval)
+	if _, err := ks.key(ctx, "k2"); err != nil {
+		t.Fatalf("rotated key not found: %v", err)
+	} else if jwks.fetchCount() != 2 {
+		t.Fatalf("key set fetched %d times, want 2", jwks.fetchCount())
+	}
+
+	raw := jwks.sign(t, "k2", testClaims(nil))
+	if _, err := verifyIDToken(ctx, ks, raw, idTokenExpectation{
+		Issuer: testIssuer, ClientID: testClientID}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckProfileSubject(t *testing.T) {
+	idt := &IDToken{Subject: "subject"}
+	tests := []struct {
+		name    string
+		profile ProfileMap
+		idToken *IDToken
+		wantErr bool
+	}{
+		{"matching", ProfileMap{"sub": "subject"}, idt, false},
+		{"mismatching", ProfileMap{"sub": "other"}, idt, true},
+		{"no sub", ProfileMap{"id": "other"}, idt, false},
+		{"no id token", ProfileMap{"sub": "other"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		err := checkProfileSubject(tt.profile, tt.idToken)
+		if tt.wantErr != errors.Is(err, ErrSubjectMismatch) || (!tt.wantErr && err != nil) {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewOIDCUsesContextClient(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	// The server's certificate is only trusted by its own client.
+	if _, err := NewOIDC(context.Background(), "oidc", srv.URL, testClientID, ""); err == nil {
+		t.Fatal("discovery succeeded without the context's client")
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, srv.Client())
+	p, err := NewOIDC(ctx, "oidc", srv.URL, testClientID, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if got := p.Endpoints().OAuth2.TokenURL; got != srv.URL+"/token" {
+		t.Errorf("token URL = %q, want %q", got, srv.URL+"/token")
+	}
+}
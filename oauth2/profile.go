@@ -1,8 +1,11 @@
 package oauth2
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type ProfileMap map[string]interface{}
@@ -11,11 +14,60 @@ type ProfileMap map[string]interface{}
 func (u ProfileMap) String(key string) string {
 	// json.Unmarshal converts json "null" value to go's "nil", in this case return empty string
 	if val, ok := u[key]; ok && val != nil {
-		return fmt.Sprintf("%v", val)
+		return stringify(val)
 	}
 	return ""
 }
 
+// Lookup returns the value at the given dot-separated path, such as "data.attributes.email", or an
+// empty string if not found.  Numeric path segments index into arrays.
+func (u ProfileMap) Lookup(path string) string {
+	if val, ok := u.LookupValue(path); ok {
+		return stringify(val)
+	}
+	return ""
+}
+
+// LookupValue returns the value at the given dot-separated path and whether it was found.  See
+// Lookup.
+func (u ProfileMap) LookupValue(path string) (interface{}, bool) {
+	var cur interface{} = map[string]interface{}(u)
+	for _, seg := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case ProfileMap:
+			next, ok := v[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+func stringify(val interface{}) string {
+	// Numeric IDs, which json.Unmarshal decodes as float64, must not be formatted in exponent
+	// notation.
+	if f, ok := val.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
 // Bool returns the value for a given key or false if not found.
 // It works with values stored as bool or string that can be parsed to bool.
 func (u ProfileMap) Bool(key string) bool {
@@ -33,15 +85,111 @@ func (u ProfileMap) Bool(key string) bool {
 	return false
 }
 
+// Strings returns the values for a given key, which may hold either a single string or an array of
+// strings, or nil if not found.
+func (u ProfileMap) Strings(key string) []string {
+	switch v := u[key].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		r := make([]string, 0, len(v))
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				r = append(r, str)
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+// Time returns the value for a given key, interpreted as a JSON numeric date (seconds since the
+// Unix epoch), and whether it was found.
+func (u ProfileMap) Time(key string) (time.Time, bool) {
+	var secs float64
+	switch v := u[key].(type) {
+	case float64:
+		secs = v
+	case int64:
+		secs = float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		secs = f
+	default:
+		return time.Time{}, false
+	}
+	return time.Unix(int64(secs), 0), true
+}
+
 type Profile struct {
-	ID          string                 `json:"id"`
-	CanonicalID string                 `json:"canonical_id"`
-	Name        string                 `json:"name"`
-	FirstName   string                 `json:"first_name"`
-	LastName    string                 `json:"last_name"`
-	Email       string                 `json:"email,omitempty"`
-	PictureURL  string                 `json:"picture_url"`
-	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+	ID          string `json:"id"`
+	CanonicalID string `json:"canonical_id"`
+	Name        string `json:"name"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email,omitempty"`
+	// EmailVerified reports whether the provider attests that the user controls Email.
+	EmailVerified bool                   `json:"email_verified"`
+	PictureURL    string                 `json:"picture_url"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// EmailPolicy determines how unverified email addresses are handled when a user authenticates.
+type EmailPolicy int
+
+const (
+	// EmailPolicyNone accepts profiles regardless of whether their email is verified.
+	EmailPolicyNone EmailPolicy = iota
+	// EmailPolicyRequireVerified rejects authentications whose profile lacks a verified email
+	// with ErrEmailNotVerified.
+	EmailPolicyRequireVerified
+	// EmailPolicyDropUnverified clears unverified emails from profiles, along with the attributes
+	// holding them, so that they cannot be relied upon, for instance to match the user to an
+	// existing account.
+	EmailPolicyDropUnverified
+)
+
+// emailAttributes lists the attributes in which providers report the user's email.
+var emailAttributes = []string{"email", "mail"}
+
+// apply enforces the policy on the given profile.
+func (p EmailPolicy) apply(profile *Profile) error {
+	if profile.EmailVerified && profile.Email != "" {
+		return nil
+	}
+
+	switch p {
+	case EmailPolicyRequireVerified:
+		return ErrEmailNotVerified
+	case EmailPolicyDropUnverified:
+		profile.Attributes = withoutEmail(profile.Attributes, profile.Email)
+		profile.Email, profile.EmailVerified = "", false
+	}
+	return nil
+}
+
+// withoutEmail returns a copy of the attributes without those holding an email, whether under one
+// of emailAttributes or under another key with the given email as value.
+func withoutEmail(attrs map[string]interface{}, email string) map[string]interface{} {
+	if attrs == nil {
+		return nil
+	}
+
+	r := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		if containsString(emailAttributes, k) {
+			continue
+		} else if s, ok := v.(string); ok && email != "" && strings.EqualFold(s, email) {
+			continue
+		}
+		r[k] = v
+	}
+	return r
 }
 
 func (u *Profile) SetBoolAttr(key string, val bool) {
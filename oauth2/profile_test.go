@@ -0,0 +1,34 @@
+package oauth2
+
+import "testing"
+
+func TestEmailPolicyDropUnverified(t *testing.T) {
+	profile := Profile{
+		Email: "user@example.com",
+		Attributes: map[string]interface{}{
+			"email":             "user@example.com",
+			"mail":              "user@example.com",
+			"userPrincipalName": "USER@example.com",
+			"login":             "user",
+		},
+	}
+	attrs := profile.Attributes
+
+	if err := EmailPolicyDropUnverified.apply(&profile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if profile.Email != "" {
+		t.Errorf("email = %q, want none", profile.Email)
+	}
+
+	for _, key := range []string{"email", "mail", "userPrincipalName"} {
+		if v, ok := profile.Attributes[key]; ok {
+			t.Errorf("attribute %s = %v, want none", key, v)
+		}
+	}
+	if profile.Attributes["login"] != "user" {
+		t.Errorf("attribute login = %v, want %q", profile.Attributes["login"], "user")
+	}
+	if len(attrs) != 4 {
+		t.Error("attributes of the original profile modified")
+	}
+}
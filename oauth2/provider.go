@@ -1,7 +1,13 @@
 package oauth2
 
 import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"golang.org/x/oauth2"
 )
@@ -13,23 +19,156 @@ type Provider interface {
 	ExtractProfile(data ProfileMap, _ []byte) (Profile, error)
 }
 
+// TokenProfileExtractor may be implemented by a Provider whose users' profiles cannot be fetched
+// from a ProfileURL, in which case the profile is built from the token response instead.  The ID
+// token is nil for providers without OpenID Connect support, and callback holds the parameters of
+// the authorization response, or nil when the token was obtained through another grant.
+type TokenProfileExtractor interface {
+	ExtractTokenProfile(token *oauth2.Token, idToken *IDToken, callback url.Values) (
+		Profile, error)
+}
+
+// AuthCodeOptioner may be implemented by a Provider that sends additional parameters to its
+// authorization endpoint, such as those required to obtain a refresh token.
+type AuthCodeOptioner interface {
+	AuthCodeOptions() []oauth2.AuthCodeOption
+}
+
+// ProfileEnricher may be implemented by a Provider that needs to make further requests with the
+// exchanged token to complete the user's profile, or to decide whether the user may log in at all.
+// The client authorizes its requests with the token, and the ID token is nil for providers without
+// OpenID Connect support.  Returning an error fails the authentication.
+type ProfileEnricher interface {
+	EnrichProfile(ctx context.Context, client *http.Client, idToken *IDToken,
+		profile *Profile) error
+}
+
 type AuthResult struct {
 	Provider    string
 	Profile     Profile
 	Token       oauth2.Token
+	IDToken     *IDToken // Verified ID token; nil unless the provider supports OpenID Connect
+	Scopes      []string // Scopes granted by the user
 	RedirectURL string
+	// UserID is the internal ID of the user the identity is linked to.  It is only set when the
+	// service is configured with an IdentityStore or a UserStore.
+	UserID string
+	// User is the persisted user, when the service is configured with a UserStore.
+	User *User
 }
 
 type AuthState struct {
 	State       string
 	Nonce       string
+	Verifier    string // PKCE code verifier (RFC 7636)
 	Audience    string
 	RedirectURL string
+	Scopes      []string      // Scopes requested in addition to the provider's
+	MaxAge      time.Duration // Maximum authentication age requested, if any
+	LinkUserID  string        // User the identity is to be linked to, if any
 }
 
+// AuthConfig configures a single authentication.  Besides where to redirect the user afterwards,
+// it allows the authorization request to be tailored, for instance to request further scopes from
+// a user who is already signed in (incremental authorization).
 type AuthConfig struct {
-	Audience    string
+	Audience string
+	// RedirectURL is where the user is to be redirected once authenticated.  It is subject to
+	// the service's RedirectPolicy, being replaced with its fallback URL if not allowed.
 	RedirectURL string
+
+	// Scopes are requested in addition to the scopes the provider is configured with.
+	Scopes []string
+	// IncludeGrantedScopes asks the provider to also include the scopes previously granted by
+	// the user in the new token, as supported by Google.
+	IncludeGrantedScopes bool
+	// Prompt controls whether the provider prompts the user for reauthentication or consent
+	// (e.g. "login", "consent", "select_account" or "none").
+	Prompt string
+	// LoginHint hints the provider about the identifier the user may use to log in.
+	LoginHint string
+	// MaxAge is the maximum time since the user last actively authenticated with the provider.
+	// It is verified against the ID token's auth_time claim.  Zero means no maximum.
+	MaxAge time.Duration
+	// HostedDomain restricts Google's account chooser to a Workspace domain.
+	HostedDomain string
+	// DomainHint hints Microsoft about the tenant domain the user belongs to.
+	DomainHint string
+	// AuthParams holds any further parameters to send to the authorization endpoint.  Parameters
+	// that the authentication flow itself controls, such as state or scope, are ignored.
+	AuthParams map[string]string
+	// LinkUserID links the identity the user authenticates with to the given internal user,
+	// typically the one currently signed in, rather than logging in as the user the identity
+	// resolves to.  It requires ServiceConfig.IdentityStore to be set.
+	LinkUserID string
+}
+
+// reservedAuthParams lists the authorization parameters that cannot be overridden through
+// AuthConfig.AuthParams.
+var reservedAuthParams = map[string]bool{
+	"client_id":             true,
+	"redirect_uri":          true,
+	"response_type":         true,
+	"response_mode":         true,
+	"scope":                 true,
+	"state":                 true,
+	"nonce":                 true,
+	"code_challenge":        true,
+	"code_challenge_method": true,
+}
+
+// authCodeOptions returns the authorization parameters described by the configuration.
+func (c AuthConfig) authCodeOptions() []oauth2.AuthCodeOption {
+	var opts []oauth2.AuthCodeOption
+	for k, v := range c.AuthParams {
+		if !reservedAuthParams[k] {
+			opts = append(opts, oauth2.SetAuthURLParam(k, v))
+		}
+	}
+
+	params := []struct{ key, value string }{
+		{"prompt", c.Prompt},
+		{"login_hint", c.LoginHint},
+		{"hd", c.HostedDomain},
+		{"domain_hint", c.DomainHint},
+	}
+	for _, p := range params {
+		if p.value != "" {
+			opts = append(opts, oauth2.SetAuthURLParam(p.key, p.value))
+		}
+	}
+
+	if c.MaxAge > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam(
+			"max_age", strconv.FormatInt(int64(c.MaxAge/time.Second), 10)))
+	}
+	if c.IncludeGrantedScopes {
+		opts = append(opts, oauth2.SetAuthURLParam("include_granted_scopes", "true"))
+	}
+	return opts
+}
+
+// mergeScopes returns the scopes of base followed by the extra scopes not already included.
+func mergeScopes(base []string, extra []string) []string {
+	scopes := append([]string{}, base...)
+	for _, scope := range extra {
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// grantedScopes returns the scopes reported in the token response or, in their absence, the
+// requested scopes as RFC 6749 mandates that the scope be reported when it differs.  Scopes are
+// separated by spaces or, as GitHub reports them, by commas.
+func grantedScopes(token *oauth2.Token, requested []string) []string {
+	if scope, ok := token.Extra("scope").(string); ok && scope != "" {
+		return strings.FieldsFunc(scope, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+	}
+	return requested
 }
 
 type StandardProviderOption func(*ProviderConfig)
@@ -39,8 +178,36 @@ type ProviderConfig struct {
 	ClientSecret string
 	Issuer       string
 	CallbackURL  string
+	Scopes       []string
+	// OfflineAccess requests that the provider issue a refresh token, allowing access tokens to
+	// be renewed after they expire.
+	OfflineAccess bool
+	// ResponseMode selects how the provider returns the authorization response.  The provider's
+	// default, usually ResponseModeQuery, is used when empty.
+	ResponseMode string
+	// AllowedOrganizations restricts login to members of the given organizations, for providers
+	// with a notion of organization membership.  How entries are interpreted is provider specific.
+	AllowedOrganizations []string
+	// Tenant selects the directory users sign in with, for multi-tenant providers such as
+	// Microsoft.
+	Tenant string
+	// AllowedTenants restricts login to users of the given tenant IDs.
+	AllowedTenants []string
+	// HostedDomains restricts login to accounts of the given Google Workspace domains.
+	HostedDomains []string
+	// AvatarSink receives the avatars of providers that serve them as binary data, such as
+	// Microsoft.  Avatars are not fetched from such providers when nil.
+	AvatarSink AvatarSink
 }
 
+const (
+	ResponseModeQuery = "query"
+	// ResponseModeFormPost makes the provider POST the authorization response to the callback.
+	// The session manager must then keep its state in cross-site capable storage; see
+	// WithCrossSiteState.
+	ResponseModeFormPost = "form_post"
+)
+
 func WithProviderIssuer(issuer string) StandardProviderOption {
 	return func(c *ProviderConfig) {
 		c.Issuer = issuer
@@ -53,6 +220,73 @@ func WithCallbackURL(callbackURL string) StandardProviderOption {
 	}
 }
 
+// WithScopes replaces the scopes a provider requests by default.
+func WithScopes(scopes ...string) StandardProviderOption {
+	return func(c *ProviderConfig) {
+		c.Scopes = scopes
+	}
+}
+
+// WithOfflineAccess requests a refresh token from the provider so that access tokens held in
+// stored sessions can be renewed.  See SessionCtl.Token.  It has no effect on providers that
+// issue refresh tokens without being asked or not at all, such as GitHub, GitLab, Gitea and Apple,
+// nor on defined providers whose endpoints are not discovered, which may list the offline_access
+// scope themselves.
+func WithOfflineAccess() StandardProviderOption {
+	return func(c *ProviderConfig) {
+		c.OfflineAccess = true
+	}
+}
+
+// WithResponseMode sets the response_mode the provider is asked to return the authorization
+// response with.
+func WithResponseMode(mode string) StandardProviderOption {
+	return func(c *ProviderConfig) {
+		c.ResponseMode = mode
+	}
+}
+
+// WithAllowedOrganizations restricts login to the members of any of the given organizations.
+// Users who belong to none of them are rejected with ErrMembershipRequired.
+func WithAllowedOrganizations(orgs ...string) StandardProviderOption {
+	return func(c *ProviderConfig) {
+		c.AllowedOrganizations = orgs
+	}
+}
+
+// WithTenant sets the tenant users sign in with.  For Microsoft, this is a tenant ID or domain, or
+// one of "common", "organizations" or "consumers".
+func WithTenant(tenant string) StandardProviderOption {
+	return func(c *ProviderConfig) {
+		c.Tenant = tenant
+	}
+}
+
+// WithAllowedTenants restricts login to users of the given tenant IDs.  Users of other tenants are
+// rejected with ErrTenantNotAllowed.
+func WithAllowedTenants(ids ...string) StandardProviderOption {
+	return func(c *ProviderConfig) {
+		c.AllowedTenants = ids
+	}
+}
+
+// WithHostedDomains restricts login to the accounts of the given Google Workspace domains, as
+// attested by the ID token's hd claim.  Other accounts are rejected with ErrHostedDomainNotAllowed.
+func WithHostedDomains(domains ...string) StandardProviderOption {
+	return func(c *ProviderConfig) {
+		c.HostedDomains = domains
+	}
+}
+
+// WithAvatarSink fetches user avatars from providers that serve them as binary data and stores them
+// in sink, whose URL is then set as the profile's PictureURL.  Use DataURLAvatarSink to embed the
+// avatar in the profile.
+func WithAvatarSink(sink AvatarSink) StandardProviderOption {
+	return func(c *ProviderConfig) {
+		c.AvatarSink = sink
+	}
+}
+
 func NewProviderConfig(clientID string, clientSecret string,
 	options []StandardProviderOption) ProviderConfig {
 	config := ProviderConfig{
@@ -65,21 +299,62 @@ func NewProviderConfig(clientID string, clientSecret string,
 	return config
 }
 
+// endpoints describes where a provider's services are located.  A provider supports OpenID
+// Connect when JWKSURL is set, in which case the ID token returned alongside the access token is
+// verified against the key set and, when given, the Issuer.  The profile is built from the ID
+// token's claims when ProfileURL is empty.  IssuerAliases lists further values accepted in the ID
+// token's iss claim, for providers that issue tokens under several forms of their issuer.  Tokens
+// are revoked on logout when RevocationURL is set.
+// EndSessionURL is informational and may be used by applications to implement RP-initiated logout.
 type endpoints struct {
-	OAuth2     oauth2.Endpoint
-	ProfileURL string
+	OAuth2        oauth2.Endpoint
+	ProfileURL    string
+	Issuer        string
+	IssuerAliases []string
+	JWKSURL       string
+	RevocationURL string
+	EndSessionURL string
 }
 
+// SupportsOIDC returns whether the provider issues ID tokens that can be verified.
+func (e endpoints) SupportsOIDC() bool { return e.JWKSURL != "" }
+
+// offlineAccessStyle represents how a provider is asked to issue a refresh token.
+type offlineAccessStyle int
+
+const (
+	// offlineAccessNone sends nothing, for providers that do not support requesting refresh
+	// tokens or that issue them regardless.
+	offlineAccessNone offlineAccessStyle = iota
+	// offlineAccessScope requests the "offline_access" scope, as defined by OpenID Connect.
+	offlineAccessScope
+	// offlineAccessParam sends the "access_type=offline" authorization parameter.
+	offlineAccessParam
+)
+
 type StandardProvider struct {
-	name      string
-	endpoints endpoints
-	scopes    []string
-	config    ProviderConfig
+	name         string
+	endpoints    endpoints
+	scopes       []string
+	offlineStyle offlineAccessStyle
+	config       ProviderConfig
 }
 
 func (p *StandardProvider) Name() string         { return p.name }
 func (p *StandardProvider) Endpoints() endpoints { return p.endpoints }
 
+// AuthCodeOptions returns the additional parameters sent to the provider's authorization endpoint.
+func (p *StandardProvider) AuthCodeOptions() []oauth2.AuthCodeOption {
+	var opts []oauth2.AuthCodeOption
+	if p.config.OfflineAccess && p.offlineStyle == offlineAccessParam {
+		opts = append(opts, oauth2.AccessTypeOffline)
+	}
+	if p.config.ResponseMode != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", p.config.ResponseMode))
+	}
+	return opts
+}
+
 func (p *StandardProvider) Configure(conf *ServiceConfig) oauth2.Config {
 	callbackURL := p.config.CallbackURL
 	if callbackURL == "" {
@@ -89,11 +364,20 @@ func (p *StandardProvider) Configure(conf *ServiceConfig) oauth2.Config {
 			"/" + strings.Trim(cbp, "/")
 	}
 
+	scopes := p.scopes
+	if len(p.config.Scopes) > 0 {
+		scopes = p.config.Scopes
+	}
+	if p.config.OfflineAccess && p.offlineStyle == offlineAccessScope &&
+		!containsString(scopes, "offline_access") {
+		scopes = append(append([]string{}, scopes...), "offline_access")
+	}
+
 	return oauth2.Config{
 		ClientID:     p.config.ClientID,
 		ClientSecret: p.config.ClientSecret,
 		Endpoint:     p.endpoints.OAuth2,
-		Scopes:       p.scopes,
+		Scopes:       scopes,
 		RedirectURL:  callbackURL,
 	}
 }
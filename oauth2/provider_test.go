@@ -0,0 +1,63 @@
+package oauth2
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestOfflineAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   Provider
+		wantScope  bool
+		wantAccess bool
+	}{
+		{"google", NewGoogle("id", "secret", WithOfflineAccess()), false, true},
+		{"microsoft", NewMicrosoft("id", "secret", WithOfflineAccess()), true, false},
+		{"github", NewGitHub("id", "secret", WithOfflineAccess()), false, false},
+		{"gitlab", NewGitLab("", "id", "secret", WithOfflineAccess()), false, false},
+		{"gitea", NewGitea("https://gitea.example.com", "id", "secret", WithOfflineAccess()),
+			false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.provider.Configure(&ServiceConfig{BaseURL: "https://example.com"})
+			if got := containsString(conf.Scopes, "offline_access"); got != tt.wantScope {
+				t.Errorf("offline_access scope requested = %v, want %v", got, tt.wantScope)
+			}
+
+			optioner, _ := tt.provider.(AuthCodeOptioner)
+			u, err := url.Parse(conf.AuthCodeURL("state", optioner.AuthCodeOptions()...))
+			if err != nil {
+				t.Fatalf("invalid auth code URL: %v", err)
+			} else if got := u.Query().Get("access_type") == "offline"; got != tt.wantAccess {
+				t.Errorf("access_type=offline sent = %v, want %v", got, tt.wantAccess)
+			}
+		})
+	}
+}
+
+func TestGrantedScopes(t *testing.T) {
+	requested := []string{"openid"}
+	tests := []struct {
+		name  string
+		scope interface{}
+		want  []string
+	}{
+		{"spaces", "openid  email", []string{"openid", "email"}},
+		{"commas", "read:user,user:email", []string{"read:user", "user:email"}},
+		{"missing", nil, requested},
+		{"empty", "", requested},
+	}
+
+	for _, tt := range tests {
+		token := (&oauth2.Token{}).WithExtra(map[string]interface{}{"scope": tt.scope})
+		if got := grantedScopes(token, requested); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: scopes = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
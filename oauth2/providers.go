@@ -1,33 +1,103 @@
 package oauth2
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/microsoft"
 )
 
+const (
+	appleIssuer = "https://appleid.apple.com"
+	// appleSecretDuration is the lifetime of the client secrets generated for Apple, which allows
+	// up to six months.  Secrets are regenerated once less than appleSecretRenewal remains.
+	appleSecretDuration = 24 * time.Hour
+	appleSecretRenewal  = time.Hour
+
+	githubAPIURL = "https://api.github.com"
+
+	microsoftLoginURL      = "https://login.microsoftonline.com/"
+	microsoftGraphURL      = "https://graph.microsoft.com/v1.0"
+	microsoftDefaultTenant = "common"
+)
+
 var (
 	_ Provider = (*googleProvider)(nil)
 	_ Provider = (*microsoftProvider)(nil)
+	_ Provider = (*oidcProvider)(nil)
+	_ Provider = (*appleProvider)(nil)
+	_ Provider = (*githubProvider)(nil)
+	_ Provider = (*gitlabProvider)(nil)
+	_ Provider = (*giteaProvider)(nil)
+
+	_ AuthCodeOptioner      = (*googleProvider)(nil)
+	_ TokenProfileExtractor = (*appleProvider)(nil)
+	_ ProfileEnricher       = (*googleProvider)(nil)
+	_ ProfileEnricher       = (*githubProvider)(nil)
+	_ ProfileEnricher       = (*microsoftProvider)(nil)
 )
 
+// microsoftTenantPattern matches tenant IDs, as opposed to the tenant aliases and domain names
+// Microsoft also accepts in place of one.
+var microsoftTenantPattern = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 type googleProvider struct {
 	StandardProvider
 }
 
+// NewGoogle creates a Google provider.  Login can be restricted to the accounts of given Google
+// Workspace domains with WithHostedDomains.
 func NewGoogle(clientID, clientSecret string, options ...StandardProviderOption) *googleProvider {
 	return &googleProvider{
 		StandardProvider{
 			name: "google",
+			// The profile is built from the verified ID token's claims, which include the
+			// user's name and picture given the profile scope.
 			endpoints: endpoints{
-				OAuth2:     google.Endpoint,
-				ProfileURL: "https://www.googleapis.com/oauth2/v3/userinfo",
+				OAuth2: google.Endpoint,
+				Issuer: "https://accounts.google.com",
+				// Google documents both forms of its issuer as valid.
+				IssuerAliases: []string{"accounts.google.com"},
+				JWKSURL:       "https://www.googleapis.com/oauth2/v3/certs",
+				RevocationURL: "https://oauth2.googleapis.com/revoke",
 			},
-			scopes: []string{"email", "https://www.googleapis.com/auth/userinfo.profile"},
-			config: NewProviderConfig(clientID, clientSecret, options),
+			scopes: []string{
+				"openid", "email", "https://www.googleapis.com/auth/userinfo.profile"},
+			// Google expects access_type=offline rather than the offline_access scope, and
+			// only issues a refresh token the first time a user consents.
+			offlineStyle: offlineAccessParam,
+			config:       NewProviderConfig(clientID, clientSecret, options),
 		},
 	}
 }
 
+// AuthCodeOptions hints Google's account chooser at the allowed Workspace domain, if any.  When
+// several domains are allowed, the chooser is limited to Workspace accounts.
+func (p *googleProvider) AuthCodeOptions() []oauth2.AuthCodeOption {
+	opts := p.StandardProvider.AuthCodeOptions()
+	switch len(p.config.HostedDomains) {
+	case 0:
+	case 1:
+		opts = append(opts, oauth2.SetAuthURLParam("hd", p.config.HostedDomains[0]))
+	default:
+		opts = append(opts, oauth2.SetAuthURLParam("hd", "*"))
+	}
+	return opts
+}
+
 func (p *googleProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
 	canonicalId := data.String("sub")
 	id, err := HashID(p.name + "_" + canonicalId)
@@ -36,31 +106,71 @@ func (p *googleProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, err
 	}
 
 	return Profile{
-		ID:          id,
-		CanonicalID: canonicalId,
-		Name:        data.String("name"),
-		FirstName:   data.String("given_name"),
-		LastName:    data.String("family_name"),
-		Email:       data.String("email"),
-		PictureURL:  data.String("picture"),
-		Attributes:  data,
+		ID:            id,
+		CanonicalID:   canonicalId,
+		Name:          data.String("name"),
+		FirstName:     data.String("given_name"),
+		LastName:      data.String("family_name"),
+		Email:         data.String("email"),
+		EmailVerified: data.Bool("email_verified"),
+		PictureURL:    data.String("picture"),
+		Attributes:    data,
 	}, nil
 }
 
+// EnrichProfile enforces the hosted domain allowlist against the ID token's hd claim, which,
+// unlike the hd authorization parameter, cannot be tampered with by the user.
+func (p *googleProvider) EnrichProfile(_ context.Context, _ *http.Client, idToken *IDToken,
+	_ *Profile) error {
+	if len(p.config.HostedDomains) < 1 {
+		return nil
+	} else if idToken == nil {
+		return fmt.Errorf("%w: hosted domain cannot be verified", ErrHostedDomainNotAllowed)
+	}
+
+	hd := idToken.Claims.String("hd")
+	for _, allowed := range p.config.HostedDomains {
+		if hd != "" && strings.EqualFold(allowed, hd) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrHostedDomainNotAllowed, hd)
+}
+
 type microsoftProvider struct {
 	StandardProvider
 }
 
+// NewMicrosoft creates a Microsoft identity platform provider.  Users of any Entra ID tenant, as
+// well as personal Microsoft accounts, may log in unless a tenant is selected with WithTenant or
+// tenants are restricted with WithAllowedTenants.  Selecting a tenant by ID also restricts login to
+// that tenant.
+//
+// The tid, oid, upn and preferred_username claims of the ID token are copied to the profile's
+// attributes.  Since Microsoft Graph serves profile photos as binary data, the profile's PictureURL
+// is only set when an avatar sink is configured with WithAvatarSink.
 func NewMicrosoft(clientID, clientSecret string, options ...StandardProviderOption) *microsoftProvider {
+	config := NewProviderConfig(clientID, clientSecret, options)
+	tenant := config.Tenant
+	if tenant == "" {
+		tenant = microsoftDefaultTenant
+	} else if microsoftTenantPattern.MatchString(tenant) &&
+		!containsString(config.AllowedTenants, tenant) {
+		config.AllowedTenants = append(config.AllowedTenants, tenant)
+	}
+
 	return &microsoftProvider{
 		StandardProvider{
 			name: "microsoft",
 			endpoints: endpoints{
-				OAuth2:     microsoft.AzureADEndpoint("common"),
-				ProfileURL: "https://graph.microsoft.com/v1.0/me",
+				OAuth2:     microsoft.AzureADEndpoint(tenant),
+				ProfileURL: microsoftGraphURL + "/me",
+				Issuer:     microsoftLoginURL + TenantIDPlaceholder + "/v2.0",
+				JWKSURL:    microsoftLoginURL + tenant + "/discovery/v2.0/keys",
 			},
-			scopes: []string{"User.Read"},
-			config: NewProviderConfig(clientID, clientSecret, options),
+			scopes:       []string{"openid", "profile", "email", "User.Read"},
+			offlineStyle: offlineAccessScope,
+			config:       config,
 		},
 	}
 }
@@ -82,3 +192,492 @@ func (p *microsoftProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile,
 		Attributes:  data,
 	}, nil
 }
+
+// EnrichProfile copies the tenant and user identifiers from the ID token to the profile, enforces
+// the tenant allowlist and fetches the user's photo when an avatar sink is configured.
+//
+// The mail property of Microsoft Graph users is managed by tenant administrators and is not
+// verified, so the email is only considered verified when the ID token attests, through the
+// optional xms_edov claim, that its domain is owned by the tenant.
+func (p *microsoftProvider) EnrichProfile(ctx context.Context, client *http.Client,
+	idToken *IDToken, profile *Profile) error {
+	if err := p.checkTenant(idToken); err != nil {
+		return err
+	}
+
+	if idToken != nil {
+		for _, claim := range []string{"tid", "oid", "upn", "preferred_username"} {
+			if v := idToken.Claims.String(claim); v != "" {
+				profile.SetStringAttr(claim, v)
+			}
+		}
+
+		profile.EmailVerified = idToken.Claims.Bool("xms_edov") && profile.Email != "" &&
+			strings.EqualFold(idToken.Claims.String("email"), profile.Email)
+	}
+
+	if p.config.AvatarSink != nil {
+		// The photo is cosmetic and failing to retrieve or store it does not fail the login.
+		if url, err := fetchAvatar(ctx, client, microsoftGraphURL+"/me/photo/$value",
+			p.config.AvatarSink, *profile); err == nil {
+			profile.PictureURL = url
+		}
+	}
+	return nil
+}
+
+func (p *microsoftProvider) checkTenant(idToken *IDToken) error {
+	if len(p.config.AllowedTenants) < 1 {
+		return nil
+	} else if idToken == nil {
+		return fmt.Errorf("%w: tenant cannot be verified", ErrTenantNotAllowed)
+	}
+
+	tid := idToken.Claims.String("tid")
+	for _, allowed := range p.config.AllowedTenants {
+		if strings.EqualFold(allowed, tid) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrTenantNotAllowed, tid)
+}
+
+type oidcProvider struct {
+	StandardProvider
+}
+
+// NewOIDC creates a provider for any OpenID Connect compliant identity provider, such as Keycloak,
+// Okta, Auth0 or Authentik.  The provider's endpoints are obtained from the discovery document
+// published under issuerURL, and its profile is built from the standard OpenID Connect claims.
+// The discovery request is made with the HTTP client carried by ctx under the oauth2.HTTPClient
+// key, if any, and is abandoned once ctx is done.
+func NewOIDC(ctx context.Context, name, issuerURL, clientID, clientSecret string,
+	options ...StandardProviderOption) (*oidcProvider, error) {
+	if name == "" {
+		return nil, fmt.Errorf("provider name is required")
+	}
+
+	ep, err := discover(ctx, issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", name, err)
+	}
+
+	return &oidcProvider{
+		StandardProvider{
+			name:         name,
+			endpoints:    ep,
+			scopes:       []string{"openid", "profile", "email"},
+			offlineStyle: offlineAccessScope,
+			config:       NewProviderConfig(clientID, clientSecret, options),
+		},
+	}, nil
+}
+
+func (p *oidcProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
+	return standardClaimsProfile(p.name, data)
+}
+
+// standardClaimsProfile builds a profile from the standard OpenID Connect claims.
+func standardClaimsProfile(provider string, data ProfileMap) (Profile, error) {
+	canonicalId := data.String("sub")
+	if canonicalId == "" {
+		return Profile{}, fmt.Errorf("sub claim missing")
+	}
+
+	id, err := HashID(provider + "_" + canonicalId)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	name := data.String("name")
+	if name == "" {
+		name = data.String("preferred_username")
+	}
+
+	return Profile{
+		ID:            id,
+		CanonicalID:   canonicalId,
+		Name:          name,
+		FirstName:     data.String("given_name"),
+		LastName:      data.String("family_name"),
+		Email:         data.String("email"),
+		EmailVerified: data.Bool("email_verified"),
+		PictureURL:    data.String("picture"),
+		Attributes:    data,
+	}, nil
+}
+
+type appleProvider struct {
+	StandardProvider
+	teamID string
+	keyID  string
+	key    *ecdsa.PrivateKey
+
+	mu           sync.Mutex
+	secret       string
+	secretExpiry time.Time
+}
+
+// NewApple creates a provider for Sign in with Apple.  clientID is the Services ID, and teamID,
+// keyID and privateKey identify the .p8 key, in PEM form, that Apple client secrets are signed
+// with.  Client secrets are generated as needed and renewed before they expire.
+//
+// Apple posts the authorization response back to the callback (response_mode=form_post), so the
+// session manager must be created with WithCrossSiteState.  The profile is built from the ID
+// token, complemented by the name Apple only sends the first time a user authorizes the client.
+func NewApple(clientID, teamID, keyID string, privateKey []byte,
+	options ...StandardProviderOption) (*appleProvider, error) {
+	key, err := jwt.ParseECPrivateKeyFromPEM(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse apple private key: %w", err)
+	}
+
+	options = append([]StandardProviderOption{WithResponseMode(ResponseModeFormPost)}, options...)
+	p := &appleProvider{
+		StandardProvider: StandardProvider{
+			name: "apple",
+			endpoints: endpoints{
+				OAuth2: oauth2.Endpoint{
+					AuthURL:   appleIssuer + "/auth/authorize",
+					TokenURL:  appleIssuer + "/auth/token",
+					AuthStyle: oauth2.AuthStyleInParams,
+				},
+				Issuer:        appleIssuer,
+				JWKSURL:       appleIssuer + "/auth/keys",
+				RevocationURL: appleIssuer + "/auth/revoke",
+			},
+			scopes: []string{"name", "email"},
+			config: NewProviderConfig(clientID, "", options),
+		},
+		teamID: teamID,
+		keyID:  keyID,
+		key:    key,
+	}
+
+	if _, err := p.clientSecret(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *appleProvider) Configure(conf *ServiceConfig) oauth2.Config {
+	c := p.StandardProvider.Configure(conf)
+	// Signing only fails on an exhausted entropy source, in which case the token request fails
+	// on the missing secret instead.
+	c.ClientSecret, _ = p.clientSecret()
+	return c
+}
+
+// clientSecret returns the JWT that authenticates the client to Apple, generating a new one if the
+// current secret is about to expire.
+func (p *appleProvider) clientSecret() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.secret != "" && now.Add(appleSecretRenewal).Before(p.secretExpiry) {
+		return p.secret, nil
+	}
+
+	expiry := now.Add(appleSecretDuration)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+		Issuer:    p.teamID,
+		Subject:   p.config.ClientID,
+		Audience:  appleIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiry.Unix(),
+	})
+	token.Header["kid"] = p.keyID
+
+	secret, err := token.SignedString(p.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign apple client secret: %w", err)
+	}
+
+	p.secret, p.secretExpiry = secret, expiry
+	return secret, nil
+}
+
+func (p *appleProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
+	canonicalId := data.String("sub")
+	id, err := HashID(p.name + "_" + canonicalId)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	return Profile{
+		ID:            id,
+		CanonicalID:   canonicalId,
+		Email:         data.String("email"),
+		EmailVerified: data.Bool("email_verified"),
+		Attributes:    data,
+	}, nil
+}
+
+// ExtractTokenProfile builds the profile from the ID token's claims.  Apple includes the user's
+// name in the "user" parameter of the authorization response, but only the first time the user
+// authorizes the client.
+func (p *appleProvider) ExtractTokenProfile(_ *oauth2.Token, idToken *IDToken,
+	callback url.Values) (Profile, error) {
+	if idToken == nil {
+		return Profile{}, ErrIDTokenMissing
+	}
+
+	profile, err := p.ExtractProfile(idToken.Claims, nil)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	userRaw := callback.Get("user")
+	if userRaw == "" {
+		return profile, nil
+	}
+
+	var user struct {
+		Name struct {
+			FirstName string `json:"firstName"`
+			LastName  string `json:"lastName"`
+		} `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(userRaw), &user); err != nil {
+		return Profile{}, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+
+	profile.FirstName = user.Name.FirstName
+	profile.LastName = user.Name.LastName
+	if profile.FirstName != "" && profile.LastName != "" {
+		profile.Name = profile.FirstName + " " + profile.LastName
+	} else {
+		profile.Name = profile.FirstName + profile.LastName
+	}
+	return profile, nil
+}
+
+type githubProvider struct {
+	StandardProvider
+}
+
+// NewGitHub creates a GitHub provider.  Since the profile returned by GitHub only includes the
+// user's public email address, if any, the primary verified address is looked up separately.
+//
+// Login can be restricted with WithAllowedOrganizations to the members of the given organizations
+// or, for entries in the "org/team" form, of the given teams.
+func NewGitHub(clientID, clientSecret string, options ...StandardProviderOption) *githubProvider {
+	return &githubProvider{
+		StandardProvider{
+			name: "github",
+			endpoints: endpoints{
+				OAuth2:     github.Endpoint,
+				ProfileURL: githubAPIURL + "/user",
+			},
+			scopes: []string{"read:user", "user:email"},
+			config: NewProviderConfig(clientID, clientSecret, options),
+		},
+	}
+}
+
+func (p *githubProvider) Configure(conf *ServiceConfig) oauth2.Config {
+	c := p.StandardProvider.Configure(conf)
+	if len(p.config.AllowedOrganizations) > 0 {
+		// Membership of organizations that keep it private is only visible with read:org.
+		c.Scopes = mergeScopes(c.Scopes, []string{"read:org"})
+	}
+	return c
+}
+
+func (p *githubProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
+	canonicalId := data.String("id")
+	id, err := HashID(p.name + "_" + canonicalId)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	name := data.String("name")
+	if name == "" {
+		name = data.String("login")
+	}
+
+	return Profile{
+		ID:          id,
+		CanonicalID: canonicalId,
+		Name:        name,
+		Email:       data.String("email"),
+		PictureURL:  data.String("avatar_url"),
+		Attributes:  data,
+	}, nil
+}
+
+// EnrichProfile sets the profile's email to the user's primary verified address and enforces
+// organization membership when required.
+func (p *githubProvider) EnrichProfile(ctx context.Context, client *http.Client, _ *IDToken,
+	profile *Profile) error {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, githubAPIURL+"/user/emails", &emails); err != nil {
+		return fmt.Errorf("failed to fetch emails: %w", err)
+	}
+
+	profile.Email, profile.EmailVerified = "", false
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			profile.Email, profile.EmailVerified = e.Email, true
+			break
+		}
+	}
+
+	if len(p.config.AllowedOrganizations) < 1 {
+		return nil
+	}
+
+	memberships, err := p.memberships(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	for _, allowed := range p.config.AllowedOrganizations {
+		for _, m := range memberships {
+			if strings.EqualFold(allowed, m) {
+				return nil
+			}
+		}
+	}
+	return ErrMembershipRequired
+}
+
+// memberships returns the logins of the organizations the user belongs to, along with the teams in
+// "org/team" form when team membership is required.
+func (p *githubProvider) memberships(ctx context.Context, client *http.Client) (
+	[]string, error) {
+	var orgs []struct {
+		Login string `json:"login"`
+	}
+	if err := getJSON(ctx, client, githubAPIURL+"/user/orgs?per_page=100", &orgs); err != nil {
+		return nil, fmt.Errorf("failed to fetch organizations: %w", err)
+	}
+
+	var memberships []string
+	for _, o := range orgs {
+		memberships = append(memberships, o.Login)
+	}
+
+	needTeams := false
+	for _, allowed := range p.config.AllowedOrganizations {
+		needTeams = needTeams || strings.Contains(allowed, "/")
+	}
+	if !needTeams {
+		return memberships, nil
+	}
+
+	var teams []struct {
+		Slug         string `json:"slug"`
+		Organization struct {
+			Login string `json:"login"`
+		} `json:"organization"`
+	}
+	if err := getJSON(ctx, client, githubAPIURL+"/user/teams?per_page=100", &teams); err != nil {
+		return nil, fmt.Errorf("failed to fetch teams: %w", err)
+	}
+
+	for _, t := range teams {
+		memberships = append(memberships, t.Organization.Login+"/"+t.Slug)
+	}
+	return memberships, nil
+}
+
+type gitlabProvider struct {
+	StandardProvider
+}
+
+// NewGitLab creates a provider for the GitLab instance located at baseURL, such as
+// https://gitlab.com or a self-hosted instance.  The groups the user belongs to are listed by full
+// path in the profile's "groups" attribute, and login can be restricted to the members of given
+// groups with WithAllowedOrganizations.
+func NewGitLab(baseURL, clientID, clientSecret string,
+	options ...StandardProviderOption) *gitlabProvider {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &gitlabProvider{
+		StandardProvider{
+			name: "gitlab",
+			endpoints: endpoints{
+				OAuth2: oauth2.Endpoint{
+					AuthURL:  baseURL + "/oauth/authorize",
+					TokenURL: baseURL + "/oauth/token",
+				},
+				ProfileURL:    baseURL + "/oauth/userinfo",
+				Issuer:        baseURL,
+				JWKSURL:       baseURL + "/oauth/discovery/keys",
+				RevocationURL: baseURL + "/oauth/revoke",
+			},
+			scopes: []string{"openid", "profile", "email"},
+			config: NewProviderConfig(clientID, clientSecret, options),
+		},
+	}
+}
+
+func (p *gitlabProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
+	return groupsProfile(&p.StandardProvider, data)
+}
+
+type giteaProvider struct {
+	StandardProvider
+}
+
+// NewGitea creates a provider for the Gitea instance located at baseURL.  The organizations the
+// user belongs to, and the teams in "org:team" form, are listed in the profile's "groups"
+// attribute, and login can be restricted to the members of given organizations or teams with
+// WithAllowedOrganizations.
+func NewGitea(baseURL, clientID, clientSecret string,
+	options ...StandardProviderOption) *giteaProvider {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &giteaProvider{
+		StandardProvider{
+			name: "gitea",
+			endpoints: endpoints{
+				OAuth2: oauth2.Endpoint{
+					AuthURL:  baseURL + "/login/oauth/authorize",
+					TokenURL: baseURL + "/login/oauth/access_token",
+				},
+				ProfileURL: baseURL + "/login/oauth/userinfo",
+				// Gitea derives its issuer from its configured root URL, which always ends
+				// with a slash.
+				Issuer:  baseURL + "/",
+				JWKSURL: baseURL + "/login/oauth/keys",
+			},
+			scopes: []string{"openid", "profile", "email", "groups"},
+			config: NewProviderConfig(clientID, clientSecret, options),
+		},
+	}
+}
+
+func (p *giteaProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
+	return groupsProfile(&p.StandardProvider, data)
+}
+
+// groupsProfile builds a profile from the standard OpenID Connect claims and the "groups" claim,
+// which is copied to the profile's "groups" attribute.  ErrMembershipRequired is returned if the
+// provider only allows given groups and the user belongs to none of them.
+func groupsProfile(p *StandardProvider, data ProfileMap) (Profile, error) {
+	profile, err := standardClaimsProfile(p.name, data)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	groups := data.Strings("groups")
+	if profile.Attributes == nil {
+		profile.Attributes = map[string]interface{}{}
+	}
+	profile.Attributes["groups"] = groups
+
+	if len(p.config.AllowedOrganizations) < 1 {
+		return profile, nil
+	}
+	for _, allowed := range p.config.AllowedOrganizations {
+		if containsString(groups, allowed) {
+			return profile, nil
+		}
+	}
+	return Profile{}, ErrMembershipRequired
+}
@@ -0,0 +1,100 @@
+package oauth2
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+const defaultFallbackURL = "/"
+
+// RedirectPolicy determines the URLs users may be redirected to once authenticated, as requested
+// through AuthConfig.RedirectURL, preventing the authentication flow from being abused as an open
+// redirect.  The zero value only allows URLs of the same origin as the service's BaseURL, which
+// includes paths relative to its root such as "/account".
+type RedirectPolicy struct {
+	// AllowedHosts lists further hosts that redirects may target.  An entry of the form
+	// "*.example.com" matches any subdomain of example.com.
+	AllowedHosts []string
+	// AllowedPathPrefixes, when set, restricts redirects to the given paths and those beneath
+	// them.  For instance, "/app" allows "/app" and "/app/settings", but not "/application".
+	AllowedPathPrefixes []string
+	// Validator, when set, is consulted for URLs that satisfy the rest of the policy and may
+	// reject them by returning false.
+	Validator func(u *url.URL) bool
+	// FallbackURL is redirected to in place of URLs rejected by the policy.  It defaults to "/".
+	FallbackURL string
+}
+
+// sanitize returns the redirect URL if allowed by the policy, or else the fallback URL.  Empty URLs
+// are returned as is.
+func (p *RedirectPolicy) sanitize(baseURL, redirectURL string) string {
+	if redirectURL == "" || p.allows(baseURL, redirectURL) {
+		return redirectURL
+	} else if p.FallbackURL != "" {
+		return p.FallbackURL
+	}
+	return defaultFallbackURL
+}
+
+func (p *RedirectPolicy) allows(baseURL, redirectURL string) bool {
+	// Browsers treat backslashes as slashes, so that "/\example.com" targets another host.
+	if strings.ContainsAny(redirectURL, "\\\x00\t\r\n") {
+		return false
+	}
+
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.User != nil || u.Opaque != "" {
+		return false
+	}
+
+	if u.Scheme == "" && u.Host == "" {
+		// Only relative URLs anchored at the root are accepted, since others resolve against
+		// the callback URL.  Paths starting with several slashes are rejected as browsers
+		// resolve them to another host.
+		if !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+			return false
+		}
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	} else if !p.allowsOrigin(baseURL, u) {
+		return false
+	}
+
+	if len(p.AllowedPathPrefixes) > 0 && !p.allowsPath(u) {
+		return false
+	}
+
+	return p.Validator == nil || p.Validator(u)
+}
+
+func (p *RedirectPolicy) allowsOrigin(baseURL string, u *url.URL) bool {
+	if base, err := url.Parse(baseURL); err == nil && base.Host != "" &&
+		strings.EqualFold(base.Scheme, u.Scheme) && strings.EqualFold(base.Host, u.Host) {
+		return true
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == allowed || strings.ToLower(u.Host) == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RedirectPolicy) allowsPath(u *url.URL) bool {
+	clean := path.Clean("/" + u.Path)
+	for _, prefix := range p.AllowedPathPrefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || clean == prefix || strings.HasPrefix(clean, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package oauth2
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRedirectPolicyAllows(t *testing.T) {
+	const baseURL = "https://app.example.com"
+
+	prefixed := RedirectPolicy{AllowedPathPrefixes: []string{"/app"}}
+	hosts := RedirectPolicy{AllowedHosts: []string{"*.example.org", "cdn.example.net:8443"}}
+	validated := RedirectPolicy{Validator: func(u *url.URL) bool {
+		return u.Query().Get("deny") == ""
+	}}
+
+	tests := []struct {
+		name   string
+		policy RedirectPolicy
+		url    string
+		want   bool
+	}{
+		{"root", RedirectPolicy{}, "/", true},
+		{"relative path", RedirectPolicy{}, "/account?tab=1", true},
+		{"same origin", RedirectPolicy{}, "https://app.example.com/account", true},
+		{"same host other scheme", RedirectPolicy{}, "http://app.example.com/", false},
+		{"other host", RedirectPolicy{}, "https://evil.com/", false},
+		{"scheme relative", RedirectPolicy{}, "//evil.com", false},
+		{"triple slash", RedirectPolicy{}, "///evil.com", false},
+		{"backslash", RedirectPolicy{}, "/\\evil.com", false},
+		{"opaque", RedirectPolicy{}, "https:evil.com", false},
+		{"userinfo", RedirectPolicy{}, "https://user@app.example.com/", false},
+		{"javascript", RedirectPolicy{}, "javascript:alert(1)", false},
+		{"unanchored", RedirectPolicy{}, "account", false},
+		{"control character", RedirectPolicy{}, "/a\nb", false},
+		{"prefix", prefixed, "/app", true},
+		{"beneath prefix", prefixed, "/app/settings", true},
+		{"sibling of prefix", prefixed, "/application", false},
+		{"traversal out of prefix", prefixed, "/app/../admin", false},
+		{"outside prefix", prefixed, "/admin", false},
+		{"wildcard host", hosts, "https://a.example.org/", true},
+		{"wildcard apex", hosts, "https://example.org/", false},
+		{"host with port", hosts, "https://cdn.example.net:8443/x", true},
+		{"host with other port", hosts, "https://cdn.example.net/x", false},
+		{"validator accepts", validated, "/x", true},
+		{"validator rejects", validated, "/x?deny=1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.allows(baseURL, tt.url); got != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectPolicySanitize(t *testing.T) {
+	const baseURL = "https://app.example.com"
+
+	tests := []struct {
+		policy RedirectPolicy
+		url    string
+		want   string
+	}{
+		{RedirectPolicy{}, "", ""},
+		{RedirectPolicy{}, "/account", "/account"},
+		{RedirectPolicy{}, "https://evil.com/", "/"},
+		{RedirectPolicy{FallbackURL: "/home"}, "///evil.com", "/home"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.sanitize(baseURL, tt.url); got != tt.want {
+			t.Errorf("sanitize(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Revoker revokes the provider-issued tokens held in an AuthResult.  It is implemented by
+// OAuth2Service.
+type Revoker interface {
+	Revoke(ctx context.Context, result AuthResult) error
+}
+
+// Revoke revokes the tokens held in the given result at the originating provider's revocation
+// endpoint, as described in RFC 7009.  The refresh token, when present, is revoked in place of the
+// access token since providers invalidate the whole grant along with it, while access tokens that
+// have already expired are skipped.  ErrRevocationUnsupported is returned if the provider does not
+// advertise a revocation endpoint.
+func (s *OAuth2Service) Revoke(ctx context.Context, result AuthResult) error {
+	provider, err := s.Provider(result.Provider)
+	if err != nil {
+		return err
+	}
+
+	revocationURL := provider.Endpoints().RevocationURL
+	if revocationURL == "" {
+		return ErrRevocationUnsupported
+	}
+
+	conf := provider.Configure(&s.config)
+	if result.Token.RefreshToken != "" {
+		return revokeToken(ctx, conf, revocationURL, result.Token.RefreshToken,
+			"refresh_token")
+	} else if result.Token.AccessToken != "" && result.Token.Valid() {
+		return revokeToken(ctx, conf, revocationURL, result.Token.AccessToken,
+			"access_token")
+	}
+
+	return nil
+}
+
+func revokeToken(ctx context.Context, conf oauth2.Config, revocationURL, token,
+	hint string) error {
+	v := url.Values{"token": {token}, "token_type_hint": {hint}}
+	if conf.Endpoint.AuthStyle == oauth2.AuthStyleInParams {
+		v.Set("client_id", conf.ClientID)
+		if conf.ClientSecret != "" {
+			v.Set("client_secret", conf.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, revocationURL,
+		strings.NewReader(v.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create revocation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if conf.Endpoint.AuthStyle != oauth2.AuthStyleInParams {
+		req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	}
+
+	resp, err := contextClient(ctx).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke %s: %w", hint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// Per RFC 7009, the server responds with 200 even if the token was already invalid, but some
+	// providers such as Google report it as an invalid_token error instead.
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	var perr struct {
+		Code        string `json:"error"`
+		Description string `json:"error_description"`
+		URI         string `json:"error_uri"`
+	}
+	if json.Unmarshal(body, &perr) == nil && perr.Code != "" {
+		if perr.Code == ErrorCodeInvalidToken {
+			return nil
+		}
+		return fmt.Errorf("failed to revoke %s: %w", hint, &ProviderError{
+			Code: perr.Code, Description: perr.Description, URI: perr.URI})
+	}
+
+	return fmt.Errorf("failed to revoke %s: unexpected status %s: %s", hint, resp.Status,
+		strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,80 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+type testProvider struct {
+	StandardProvider
+}
+
+func (p *testProvider) ExtractProfile(data ProfileMap, _ []byte) (Profile, error) {
+	return Profile{ID: data.String("sub"), CanonicalID: data.String("sub")}, nil
+}
+
+func TestRevoke(t *testing.T) {
+	var revoked []string
+	var respond func(w http.ResponseWriter)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		revoked = append(revoked, r.FormValue("token_type_hint"))
+		respond(w)
+	}))
+	defer srv.Close()
+
+	svc := NewService(ServiceConfig{})
+	svc.Register(&testProvider{StandardProvider{
+		name:      "test",
+		endpoints: endpoints{RevocationURL: srv.URL},
+	}})
+
+	ok := func(w http.ResponseWriter) {}
+	invalidToken := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_token","error_description":"Token expired or revoked"}`))
+	}
+	invalidClient := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid_client"}`))
+	}
+
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	tests := []struct {
+		name    string
+		token   oauth2.Token
+		respond func(w http.ResponseWriter)
+		revoked []string
+		wantErr bool
+	}{
+		{"refresh token only", oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: future},
+			ok, []string{"refresh_token"}, false},
+		{"valid access token", oauth2.Token{AccessToken: "a", Expiry: future},
+			ok, []string{"access_token"}, false},
+		{"expired access token", oauth2.Token{AccessToken: "a", Expiry: past},
+			ok, nil, false},
+		{"already invalid", oauth2.Token{AccessToken: "a", Expiry: future},
+			invalidToken, []string{"access_token"}, false},
+		{"provider error", oauth2.Token{AccessToken: "a", Expiry: future},
+			invalidClient, []string{"access_token"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, respond = nil, tt.respond
+			err := svc.Revoke(context.Background(), AuthResult{Provider: "test", Token: tt.token})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Revoke() error = %v, want error %v", err, tt.wantErr)
+			} else if len(revoked) != len(tt.revoked) ||
+				(len(revoked) > 0 && revoked[0] != tt.revoked[0]) {
+				t.Errorf("revoked %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
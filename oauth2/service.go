@@ -1,8 +1,11 @@
 package oauth2
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+
+	"golang.org/x/oauth2"
 )
 
 const (
@@ -25,6 +28,18 @@ type ServiceConfig struct {
 	BaseURL              string // Base URL for the service
 	CallbackPathTemplate string // Universal callback path
 	SessionManager       SessionManager
+	EmailPolicy          EmailPolicy // How unverified emails are handled
+	// IdentityStore, when set, resolves the internal user ID of authenticated users so that
+	// several provider identities can belong to the same user.  See AuthConfig.LinkUserID.
+	IdentityStore IdentityStore
+	// UserStore, when set, is updated with the users who log in.  See AuthResult.User.
+	UserStore UserStore
+	// Hooks are invoked at the steps of the authentication flow, including the creation and
+	// deletion of sessions by the service's handler and the session controllers associated with
+	// the service.
+	Hooks Hooks
+	// RedirectPolicy restricts the URLs users are redirected to once authenticated.
+	RedirectPolicy RedirectPolicy
 }
 
 type providers map[string]Provider
@@ -32,6 +47,7 @@ type providers map[string]Provider
 type OAuth2Service struct {
 	config    ServiceConfig
 	providers providers
+	keySets   *keySetCache
 }
 
 func NewService(config ServiceConfig) OAuth2Service {
@@ -41,7 +57,8 @@ func NewService(config ServiceConfig) OAuth2Service {
 
 	return OAuth2Service{
 		config:    config,
-		providers: map[string]Provider{}}
+		providers: map[string]Provider{},
+		keySets:   newKeySetCache()}
 }
 
 func (s *OAuth2Service) Register(provider Provider) {
@@ -52,7 +69,7 @@ func (s *OAuth2Service) Provider(name string) (Provider, error) {
 	if name == "" {
 		return nil, ErrNoProvider
 	} else if prov, ok := s.providers[name]; !ok {
-		return nil, fmt.Errorf("invalid provider name specified: %s", name)
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
 	} else {
 		return prov, nil
 	}
@@ -65,5 +82,38 @@ func (s *OAuth2Service) NewAuthenticator(name string) (Authenticator, error) {
 	}
 
 	return &authenticator{
-		svcConf: &s.config, session: s.config.SessionManager, provider: provider}, nil
+		svcConf:  &s.config,
+		session:  s.config.SessionManager,
+		provider: provider,
+		keySets:  s.keySets}, nil
+}
+
+// NewDeviceAuthenticator returns an authenticator that implements the device authorization grant
+// for the named provider.  ErrDeviceFlowUnsupported is returned if the provider has no device
+// authorization endpoint.
+func (s *OAuth2Service) NewDeviceAuthenticator(name string) (DeviceAuthenticator, error) {
+	provider, err := s.Provider(name)
+	if err != nil {
+		return nil, err
+	} else if provider.Endpoints().OAuth2.DeviceAuthURL == "" {
+		return nil, ErrDeviceFlowUnsupported
+	}
+
+	return &deviceAuthenticator{
+		svcConf:  &s.config,
+		provider: provider,
+		keySets:  s.keySets}, nil
+}
+
+// TokenSource returns a token source that yields the access token held in the given result and
+// renews it through the originating provider once it expires, provided a refresh token was issued.
+func (s *OAuth2Service) TokenSource(ctx context.Context, result AuthResult) (
+	oauth2.TokenSource, error) {
+	provider, err := s.Provider(result.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := provider.Configure(&s.config)
+	return conf.TokenSource(ctx, &result.Token), nil
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/midsbie/authagon/store"
+	"golang.org/x/oauth2"
 )
 
 const (
@@ -28,52 +29,119 @@ type sessionControlResult struct {
 
 func (scr *sessionControlResult) SID() string { return scr.sid }
 
+// TokenSourcer creates token sources for the provider an AuthResult originates from.  It is
+// implemented by OAuth2Service.
+type TokenSourcer interface {
+	TokenSource(ctx context.Context, result AuthResult) (oauth2.TokenSource, error)
+}
+
+// AuthSession is implemented by session values that hold an AuthResult, which TypedSessionCtl
+// relies upon to refresh tokens and revoke them on logout.  It is implemented by *AuthResult and,
+// through embedding, by pointers to application session types such as:
+//
+//	type Session struct {
+//		oauth2.AuthResult
+//		Preferences map[string]string
+//	}
+type AuthSession interface {
+	Auth() *AuthResult
+}
+
+// Auth returns the result itself, so that *AuthResult implements AuthSession.
+func (a *AuthResult) Auth() *AuthResult { return a }
+
 // sessionCtlOption is the type for functional options.
-type sessionCtlOption func(*SessionCtl)
+type sessionCtlOption func(*sessionCtlConfig)
 
 func WithSessionIDKey(sessionIDKey string) sessionCtlOption {
-	return func(sc *SessionCtl) {
+	return func(sc *sessionCtlConfig) {
 		sc.sessionIDKey = sessionIDKey
 	}
 }
 
 func WithSessionIDKeyLen(len int) sessionCtlOption {
-	return func(sc *SessionCtl) {
+	return func(sc *sessionCtlConfig) {
 		sc.sessionIDKeyLen = len
 	}
 }
 
 func WithSessionDuration(sessionDuration time.Duration) sessionCtlOption {
-	return func(sc *SessionCtl) {
+	return func(sc *sessionCtlConfig) {
 		sc.sessionDuration = sessionDuration
 	}
 }
 
-type SessionCtl struct {
-	sessionIDKey    string
-	sessionIDKeyLen int
-	sessionDuration time.Duration
-	browserStore    store.BrowserStorer
-	sessionStore    store.SessionStorer
+// WithStrictRevocation makes Logout fail, leaving the session intact, when the provider tokens
+// cannot be revoked.  By default revocation is best-effort and the session is deleted regardless.
+func WithStrictRevocation(strict bool) sessionCtlOption {
+	return func(sc *sessionCtlConfig) {
+		sc.strictRevocation = strict
+	}
 }
 
-func NewSessionCtl(browserStore store.BrowserStorer, sessionStore store.SessionStorer,
-	options ...sessionCtlOption) *SessionCtl {
-	sc := &SessionCtl{
-		sessionIDKey:    DefaultSessionIDKey,
-		sessionIDKeyLen: defaultSessionIDLength,
-		sessionDuration: defaultSessionDuration,
-		browserStore:    browserStore,
-		sessionStore:    sessionStore}
+// WithService associates the controller with the service, whose hooks are then invoked when
+// sessions are created and deleted: OnLoginFailure when a session cannot be created, and OnLogout
+// when one is deleted.  The handler returned by OAuth2Service.Handler invokes the hooks of its
+// service regardless.
+func WithService(svc *OAuth2Service) sessionCtlOption {
+	return func(sc *sessionCtlConfig) {
+		sc.hooks = &svc.config.Hooks
+	}
+}
+
+type sessionCtlConfig struct {
+	sessionIDKey     string
+	sessionIDKeyLen  int
+	sessionDuration  time.Duration
+	strictRevocation bool
+	hooks            *Hooks
+}
+
+// TypedSessionCtl controls sessions holding values of type T, typically an application-defined
+// struct embedding the AuthResult along with application data.
+type TypedSessionCtl[T AuthSession] struct {
+	sessionCtlConfig
+	browserStore store.BrowserStorer
+	sessionStore store.TypedSessionStorer[T]
+}
+
+// NewTypedSessionCtl creates a controller for sessions of type T.  Existing stores can be adapted
+// to sessionStore with store.Typed.
+func NewTypedSessionCtl[T AuthSession](browserStore store.BrowserStorer,
+	sessionStore store.TypedSessionStorer[T], options ...sessionCtlOption) *TypedSessionCtl[T] {
+	sc := &TypedSessionCtl[T]{
+		sessionCtlConfig: sessionCtlConfig{
+			sessionIDKey:    DefaultSessionIDKey,
+			sessionIDKeyLen: defaultSessionIDLength,
+			sessionDuration: defaultSessionDuration},
+		browserStore: browserStore,
+		sessionStore: sessionStore}
 
 	for _, option := range options {
-		option(sc)
+		option(&sc.sessionCtlConfig)
 	}
 	return sc
 }
 
-func (s *SessionCtl) Set(ctx context.Context, w http.ResponseWriter,
-	a AuthResult) (SessionControlReporter, error) {
+// Set creates a session holding the given value.
+func (s *TypedSessionCtl[T]) Set(ctx context.Context, w http.ResponseWriter,
+	v T) (SessionControlReporter, error) {
+	return s.create(ctx, w, v, s.hooks)
+}
+
+// create is like Set but invokes the given hooks rather than those of the controller.
+func (s *TypedSessionCtl[T]) create(ctx context.Context, w http.ResponseWriter, v T,
+	hooks *Hooks) (SessionControlReporter, error) {
+	resp, err := s.set(ctx, w, v)
+	if err != nil {
+		hooks.loginFailure(ctx, v.Auth().Provider, err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *TypedSessionCtl[T]) set(ctx context.Context, w http.ResponseWriter,
+	v T) (SessionControlReporter, error) {
 	sid, err := RandomToken(s.sessionIDKeyLen)
 	if err != nil {
 		return nil, errors.New("failed to generate session ID")
@@ -81,7 +149,7 @@ func (s *SessionCtl) Set(ctx context.Context, w http.ResponseWriter,
 
 	if err = s.browserStore.Set(w, s.sessionIDKey, sid, s.sessionDuration); err != nil {
 		return nil, fmt.Errorf("failed to create session cookie: %w", err)
-	} else if resp, err := s.sessionStore.Set(ctx, sid, a, s.sessionDuration); err == nil {
+	} else if resp, err := s.sessionStore.Set(ctx, sid, v, s.sessionDuration); err == nil {
 		return &sessionControlResult{resp, sid}, nil
 	}
 
@@ -98,26 +166,66 @@ func (s *SessionCtl) Set(ctx context.Context, w http.ResponseWriter,
 	return nil, fmt.Errorf("failed to create session: %w", err)
 }
 
-func (s *SessionCtl) Get(ctx context.Context, r *http.Request) (interface{}, bool, error) {
+// Get returns the value of the session associated with the request.
+func (s *TypedSessionCtl[T]) Get(ctx context.Context, r *http.Request) (T, bool, error) {
+	var zero T
 	sid, ok, err := s.GetSessionID(r)
+	if err != nil || !ok {
+		return zero, false, err
+	}
+
+	v, ok, err := s.sessionStore.Get(ctx, sid)
 	if err != nil {
-		return false, false, err
+		return zero, false, fmt.Errorf(
+			"error retrieving session (sid=%s) from store: %s", sid, err.Error())
 	} else if !ok {
-		return false, false, nil
+		return zero, false, nil
 	}
 
-	ab, ok, err := s.sessionStore.Get(ctx, sid)
+	return v, true, nil
+}
+
+// Logout revokes the provider-issued tokens held in the session associated with the request and
+// then deletes the session.  Providers without a revocation endpoint are skipped.  Revocation
+// failures are ignored unless strict revocation is enabled, in which case the error is returned and
+// the session is not deleted.
+func (s *TypedSessionCtl[T]) Logout(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	rv Revoker) error {
+	return s.logout(ctx, w, r, rv, s.hooks)
+}
+
+// logout is like Logout but invokes the given hooks rather than those of the controller.
+func (s *TypedSessionCtl[T]) logout(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	rv Revoker, hooks *Hooks) error {
+	sid, ok, err := s.GetSessionID(r)
 	if err != nil {
-		return AuthResult{}, false, fmt.Errorf(
-			"error retrieving session (sid=%s) from store: %s", sid, err.Error())
+		return err
 	} else if !ok {
-		return AuthResult{}, false, nil
+		return ErrUnauthenticated
 	}
 
-	return ab, true, nil
+	v, ok, err := s.sessionStore.Get(ctx, sid)
+	if err != nil {
+		return fmt.Errorf("error retrieving session (sid=%s) from store: %s", sid, err.Error())
+	}
+
+	if ok {
+		err = rv.Revoke(ctx, *v.Auth())
+		if err != nil && !errors.Is(err, ErrRevocationUnsupported) && s.strictRevocation {
+			return fmt.Errorf("failed to revoke tokens (%s): %w", sid, err)
+		}
+	}
+
+	return s.del(ctx, w, r, hooks)
+}
+
+func (s *TypedSessionCtl[T]) Del(ctx context.Context, w http.ResponseWriter,
+	r *http.Request) error {
+	return s.del(ctx, w, r, s.hooks)
 }
 
-func (s *SessionCtl) Del(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+func (s *TypedSessionCtl[T]) del(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	hooks *Hooks) error {
 	sid, ok, err := s.GetSessionID(r)
 	if err != nil {
 		return err
@@ -125,16 +233,68 @@ func (s *SessionCtl) Del(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return ErrUnauthenticated
 	}
 
+	var result *AuthResult
+	if hooks != nil && hooks.OnLogout != nil {
+		if v, ok, err := s.sessionStore.Get(ctx, sid); err == nil && ok {
+			result = v.Auth()
+		}
+	}
+
 	if err = s.sessionStore.Del(ctx, sid); err != nil {
 		return fmt.Errorf("failed to delete session (%s): %w", sid, err)
 	} else if err = s.browserStore.Del(w, s.sessionIDKey); err != nil {
 		return fmt.Errorf("failed to delete session cookie (%s): %w", sid, err)
 	}
 
+	hooks.logout(ctx, sid, result)
 	return nil
 }
 
-func (s *SessionCtl) GetSessionID(r *http.Request) (string, bool, error) {
+// Token returns a valid access token for the session associated with the request.  When the stored
+// token has expired it is renewed through the provider and the session is updated with the new
+// token.  Failure to renew the token is reported as an error wrapping ErrTokenRefresh, which
+// typically means the user must authenticate again.
+func (s *TypedSessionCtl[T]) Token(ctx context.Context, r *http.Request, ts TokenSourcer) (
+	*oauth2.Token, error) {
+	sid, ok, err := s.GetSessionID(r)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	v, ok, err := s.sessionStore.Get(ctx, sid)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"error retrieving session (sid=%s) from store: %s", sid, err.Error())
+	} else if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	result := v.Auth()
+	if result.Token.Valid() {
+		return &result.Token, nil
+	}
+
+	src, err := ts.TokenSource(ctx, *result)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := src.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenRefresh, asProviderError(err))
+	}
+
+	result.Token = *token
+	if _, err = s.sessionStore.Set(ctx, sid, v, s.sessionDuration); err != nil {
+		return nil, fmt.Errorf("failed to update session (%s): %w", sid, err)
+	}
+
+	return token, nil
+}
+
+func (s *TypedSessionCtl[T]) GetSessionID(r *http.Request) (string, bool, error) {
 	sid, ok, err := s.browserStore.Get(r, s.sessionIDKey)
 	if err != nil {
 		return "", false, fmt.Errorf("failed to retrieve session ID: %w", err)
@@ -146,3 +306,86 @@ func (s *SessionCtl) GetSessionID(r *http.Request) (string, bool, error) {
 
 	return sid, true, nil
 }
+
+// SessionCtl controls sessions holding an AuthResult in a store of untyped values.  It adapts a
+// TypedSessionCtl, whose methods it shares other than Set and Get.
+type SessionCtl struct {
+	*TypedSessionCtl[*AuthResult]
+	sessionStore store.SessionStorer
+}
+
+func NewSessionCtl(browserStore store.BrowserStorer, sessionStore store.SessionStorer,
+	options ...sessionCtlOption) *SessionCtl {
+	return &SessionCtl{
+		TypedSessionCtl: NewTypedSessionCtl[*AuthResult](
+			browserStore, &authResultStore{sessionStore}, options...),
+		sessionStore: sessionStore}
+}
+
+// Set creates a session holding the authentication result, along with the persisted user attached
+// to it when the service is configured with a UserStore.
+func (s *SessionCtl) Set(ctx context.Context, w http.ResponseWriter,
+	a AuthResult) (SessionControlReporter, error) {
+	return s.TypedSessionCtl.Set(ctx, w, &a)
+}
+
+func (s *SessionCtl) Get(ctx context.Context, r *http.Request) (interface{}, bool, error) {
+	sid, ok, err := s.GetSessionID(r)
+	if err != nil {
+		return false, false, err
+	} else if !ok {
+		return false, false, nil
+	}
+
+	ab, ok, err := s.sessionStore.Get(ctx, sid)
+	if err != nil {
+		return AuthResult{}, false, fmt.Errorf(
+			"error retrieving session (sid=%s) from store: %s", sid, err.Error())
+	} else if !ok {
+		return AuthResult{}, false, nil
+	}
+
+	return ab, true, nil
+}
+
+// authResultStore adapts a store of untyped values holding AuthResult values, as stored by
+// SessionCtl, to a typed store.
+type authResultStore struct {
+	store store.SessionStorer
+}
+
+func (s *authResultStore) Set(ctx context.Context, sid string, value *AuthResult,
+	duration time.Duration) (store.SessionResultReporter, error) {
+	return s.store.Set(ctx, sid, *value, duration)
+}
+
+func (s *authResultStore) Get(ctx context.Context, sid string) (*AuthResult, bool, error) {
+	v, ok, err := s.store.Get(ctx, sid)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	result, ok := asAuthResult(v)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected session type: %T", v)
+	}
+	return &result, true, nil
+}
+
+func (s *authResultStore) Del(ctx context.Context, sid string) error {
+	return s.store.Del(ctx, sid)
+}
+
+// asAuthResult returns the AuthResult held in a session value, which stores may hand back either by
+// value or by pointer.
+func asAuthResult(sess interface{}) (AuthResult, bool) {
+	switch v := sess.(type) {
+	case AuthResult:
+		return v, true
+	case *AuthResult:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return AuthResult{}, false
+}
@@ -0,0 +1,178 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var _ UserStore = (*MemoryUserStore)(nil)
+
+// User is a user persisted by a UserStore.
+type User struct {
+	ID         string     `json:"id"`
+	Profile    Profile    `json:"profile"` // Profile of the user's latest login
+	Identities []Identity `json:"identities"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// hasIdentity returns whether the identity belongs to the user.
+func (u *User) hasIdentity(identity Identity) bool {
+	for _, id := range u.Identities {
+		if id == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// UserStore persists the users who log in.  When set as ServiceConfig.UserStore, users are created
+// the first time they log in and their profile is updated on subsequent logins.  The resulting user
+// is attached to the AuthResult, and hence to the session stored by SessionCtl.Set.
+type UserStore interface {
+	// Find returns the user with the given ID.  It returns false if there is none.
+	Find(ctx context.Context, id string) (*User, bool, error)
+	// FindByIdentity returns the user the identity belongs to.  It returns false if there is none.
+	FindByIdentity(ctx context.Context, identity Identity) (*User, bool, error)
+	// Create persists a new user along with its identities.
+	Create(ctx context.Context, user *User) error
+	// Update persists the profile and identities of an existing user.
+	Update(ctx context.Context, user *User) error
+}
+
+// upsertUser creates or updates the user the result authenticates and attaches it to the result.
+// When an IdentityStore is configured, it is the source of truth: the user is looked up by the ID
+// the identity resolved to, and its identities are those linked to it.  Otherwise, the user is
+// looked up by the result's identity.
+func upsertUser(ctx context.Context, users UserStore, identities IdentityStore,
+	result *AuthResult) error {
+	identity := result.Identity()
+	linked := []Identity{identity}
+	resolved := identities != nil && result.UserID != ""
+
+	var user *User
+	var ok bool
+	var err error
+	if resolved {
+		if linked, err = identities.Identities(ctx, result.UserID); err != nil {
+			return fmt.Errorf("failed to retrieve identities: %w", err)
+		}
+		user, ok, err = users.Find(ctx, result.UserID)
+	} else {
+		user, ok, err = users.FindByIdentity(ctx, identity)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	now := time.Now()
+	if !ok {
+		userID := result.UserID
+		if userID == "" {
+			userID = result.Profile.ID
+		}
+
+		user = &User{
+			ID:         userID,
+			Profile:    result.Profile,
+			Identities: linked,
+			CreatedAt:  now,
+			UpdatedAt:  now}
+		if err := users.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+	} else {
+		if resolved {
+			user.Identities = linked
+		} else if !user.hasIdentity(identity) {
+			user.Identities = append(user.Identities, identity)
+		}
+		user.Profile, user.UpdatedAt = result.Profile, now
+		if err := users.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	result.User, result.UserID = user, user.ID
+	return nil
+}
+
+// MemoryUserStore is a UserStore that keeps users in memory.  It is mostly useful for development
+// and testing since users are lost when the process exits.
+type MemoryUserStore struct {
+	mu         sync.RWMutex
+	users      map[string]User
+	identities map[Identity]string
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users:      map[string]User{},
+		identities: map[Identity]string{}}
+}
+
+func (s *MemoryUserStore) Find(ctx context.Context, id string) (*User, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.get(id)
+}
+
+func (s *MemoryUserStore) FindByIdentity(ctx context.Context, identity Identity) (
+	*User, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, ok := s.identities[identity]
+	if !ok {
+		return nil, false, nil
+	}
+	return s.get(userID)
+}
+
+func (s *MemoryUserStore) get(id string) (*User, bool, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return nil, false, nil
+	}
+
+	user.Identities = append([]Identity{}, user.Identities...)
+	return &user, true, nil
+}
+
+func (s *MemoryUserStore) Create(ctx context.Context, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; ok {
+		return fmt.Errorf("user already exists: %s", user.ID)
+	}
+	s.put(user)
+	return nil
+}
+
+func (s *MemoryUserStore) Update(ctx context.Context, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.users[user.ID]
+	if !ok {
+		return fmt.Errorf("user not found: %s", user.ID)
+	}
+	for _, identity := range prev.Identities {
+		delete(s.identities, identity)
+	}
+	s.put(user)
+	return nil
+}
+
+func (s *MemoryUserStore) put(user *User) {
+	u := *user
+	u.Identities = append([]Identity{}, user.Identities...)
+	s.users[u.ID] = u
+	for _, identity := range u.Identities {
+		s.identities[identity] = u.ID
+	}
+}
@@ -0,0 +1,213 @@
+package oauth2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var _ UserStore = (*SQLUserStore)(nil)
+
+const (
+	defaultUserTable     = "users"
+	defaultIdentityTable = "user_identities"
+)
+
+// sqlUserStoreOption is the type for functional options.
+type sqlUserStoreOption func(*SQLUserStore)
+
+// WithUserTable sets the name of the table users are stored in.
+func WithUserTable(name string) sqlUserStoreOption {
+	return func(s *SQLUserStore) {
+		s.userTable = name
+	}
+}
+
+// WithIdentityTable sets the name of the table user identities are stored in.
+func WithIdentityTable(name string) sqlUserStoreOption {
+	return func(s *SQLUserStore) {
+		s.identityTable = name
+	}
+}
+
+// WithNumberedPlaceholders makes queries use numbered placeholders ($1, $2...), as required by
+// PostgreSQL, instead of question marks.
+func WithNumberedPlaceholders() sqlUserStoreOption {
+	return func(s *SQLUserStore) {
+		s.numbered = true
+	}
+}
+
+// SQLUserStore is a UserStore backed by a database/sql database.  The tables are expected to exist
+// and to be compatible with the following schema, the profile being stored as JSON:
+//
+//	CREATE TABLE users (
+//	    id         VARCHAR(255) PRIMARY KEY,
+//	    profile    TEXT NOT NULL,
+//	    created_at TIMESTAMP NOT NULL,
+//	    updated_at TIMESTAMP NOT NULL
+//	);
+//
+//	CREATE TABLE user_identities (
+//	    provider     VARCHAR(255) NOT NULL,
+//	    canonical_id VARCHAR(255) NOT NULL,
+//	    user_id      VARCHAR(255) NOT NULL REFERENCES users (id),
+//	    PRIMARY KEY (provider, canonical_id)
+//	);
+type SQLUserStore struct {
+	db            *sql.DB
+	userTable     string
+	identityTable string
+	numbered      bool
+}
+
+func NewSQLUserStore(db *sql.DB, options ...sqlUserStoreOption) *SQLUserStore {
+	s := &SQLUserStore{
+		db:            db,
+		userTable:     defaultUserTable,
+		identityTable: defaultIdentityTable}
+
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *SQLUserStore) FindByIdentity(ctx context.Context, identity Identity) (
+	*User, bool, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx, s.query(
+		"SELECT user_id FROM %[2]s WHERE provider = ? AND canonical_id = ?"),
+		identity.Provider, identity.CanonicalID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to query identity: %w", err)
+	}
+
+	return s.Find(ctx, userID)
+}
+
+func (s *SQLUserStore) Find(ctx context.Context, userID string) (*User, bool, error) {
+	user := User{ID: userID}
+	var profile string
+	err := s.db.QueryRowContext(ctx, s.query(
+		"SELECT profile, created_at, updated_at FROM %[1]s WHERE id = ?"),
+		userID).Scan(&profile, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to query user: %w", err)
+	} else if err = json.Unmarshal([]byte(profile), &user.Profile); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal profile: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.query(
+		"SELECT provider, canonical_id FROM %[2]s WHERE user_id = ?"), userID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query identities: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id Identity
+		if err := rows.Scan(&id.Provider, &id.CanonicalID); err != nil {
+			return nil, false, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		user.Identities = append(user.Identities, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to query identities: %w", err)
+	}
+
+	return &user, true, nil
+}
+
+func (s *SQLUserStore) Create(ctx context.Context, user *User) error {
+	profile, err := json.Marshal(user.Profile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile: %w", err)
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.query(
+			"INSERT INTO %[1]s (id, profile, created_at, updated_at) VALUES (?, ?, ?, ?)"),
+			user.ID, string(profile), user.CreatedAt.UTC(), user.UpdatedAt.UTC()); err != nil {
+			return fmt.Errorf("failed to insert user: %w", err)
+		}
+		return s.insertIdentities(ctx, tx, user)
+	})
+}
+
+func (s *SQLUserStore) Update(ctx context.Context, user *User) error {
+	profile, err := json.Marshal(user.Profile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile: %w", err)
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.query(
+			"UPDATE %[1]s SET profile = ?, updated_at = ? WHERE id = ?"),
+			string(profile), user.UpdatedAt.UTC(), user.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		} else if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("user not found: %s", user.ID)
+		}
+
+		if _, err := tx.ExecContext(ctx, s.query(
+			"DELETE FROM %[2]s WHERE user_id = ?"), user.ID); err != nil {
+			return fmt.Errorf("failed to delete identities: %w", err)
+		}
+		return s.insertIdentities(ctx, tx, user)
+	})
+}
+
+func (s *SQLUserStore) insertIdentities(ctx context.Context, tx *sql.Tx, user *User) error {
+	q := s.query("INSERT INTO %[2]s (provider, canonical_id, user_id) VALUES (?, ?, ?)")
+	for _, id := range user.Identities {
+		if _, err := tx.ExecContext(ctx, q, id.Provider, id.CanonicalID, user.ID); err != nil {
+			return fmt.Errorf("failed to insert identity: %w", err)
+		}
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction, which is committed if fn succeeds and rolled back otherwise.
+func (s *SQLUserStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// query formats the query with the user and identity table names, and numbers its placeholders
+// if required.
+func (s *SQLUserStore) query(format string) string {
+	q := fmt.Sprintf(format, s.userTable, s.identityTable)
+	if !s.numbered {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUnlinkedIdentityLogsInAsNewUser(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(ServiceConfig{
+		IdentityStore: NewMemoryIdentityStore(),
+		UserStore:     NewMemoryUserStore()})
+
+	login := func(provider, canonicalID, linkUserID string) *AuthResult {
+		t.Helper()
+		result := &AuthResult{
+			Provider: provider,
+			Profile:  Profile{ID: provider + "-" + canonicalID, CanonicalID: canonicalID}}
+		if err := finishAuthResult(ctx, &svc.config, result, linkUserID); err != nil {
+			t.Fatalf("login with %s failed: %v", provider, err)
+		}
+		return result
+	}
+
+	google := login("google", "1", "")
+	microsoft := login("microsoft", "2", google.UserID)
+	if microsoft.UserID != google.UserID {
+		t.Fatalf("linked login resolved to %q, want %q", microsoft.UserID, google.UserID)
+	} else if n := len(microsoft.User.Identities); n != 2 {
+		t.Fatalf("user has %d identities, want 2", n)
+	}
+
+	if err := svc.UnlinkIdentity(ctx, google.UserID, microsoft.Identity()); err != nil {
+		t.Fatalf("unlink failed: %v", err)
+	}
+
+	again := login("microsoft", "2", "")
+	if again.UserID == google.UserID || again.User.ID != again.UserID {
+		t.Fatalf("unlinked identity resolved to user %q (record %q)", again.UserID,
+			again.User.ID)
+	}
+
+	user, ok, err := svc.config.UserStore.Find(ctx, google.UserID)
+	if err != nil || !ok {
+		t.Fatalf("user not found: %v", err)
+	} else if user.hasIdentity(microsoft.Identity()) {
+		t.Errorf("unlinked identity still listed: %v", user.Identities)
+	}
+
+	if err := svc.UnlinkIdentity(ctx, google.UserID, google.Identity()); !errors.Is(err, ErrLastIdentity) {
+		t.Errorf("unlinking the last identity returned %v, want ErrLastIdentity", err)
+	}
+}
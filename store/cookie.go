@@ -47,6 +47,11 @@ func WithSameSite(sameSite http.SameSite) CookieStoreOption {
 	}
 }
 
+var (
+	_ BrowserStorer   = (*CookieStore)(nil)
+	_ CrossSiteStorer = (*CookieStore)(nil)
+)
+
 // CookieStore implements the Store interface for cookies.
 type CookieStore struct {
 	path     string
@@ -103,6 +108,19 @@ func (cs *CookieStore) Del(w http.ResponseWriter, name string) error {
 	return nil
 }
 
+// CrossSite returns a copy of the CookieStore whose cookies are also sent along with cross-site
+// requests, by setting SameSite=None.  Browsers only accept such cookies when they are Secure, so
+// the Secure flag is set as well.
+//
+// This is required for cookies that must survive a cross-site POST, such as an OAuth2 state cookie
+// read from a callback made with response_mode=form_post.
+func (cs *CookieStore) CrossSite() BrowserStorer {
+	c := *cs
+	c.sameSite = http.SameSiteNoneMode
+	c.secure = true
+	return &c
+}
+
 // setCookie is a private helper function to configure and set a cookie.
 func (cs *CookieStore) setCookie(w http.ResponseWriter, name, value string, expires time.Time) {
 	cookie := &http.Cookie{
@@ -2,7 +2,6 @@ package store
 
 import (
 	"context"
-	"fmt"
 	"time"
 )
 
@@ -23,12 +22,10 @@ func (s *MemoryStore) Set(ctx context.Context, sid string, value interface{},
 	return NewSessionResult(false), nil
 }
 
+// Get returns the value of the session, or false if no session exists under the ID.
 func (s *MemoryStore) Get(ctx context.Context, sid string) (interface{}, bool, error) {
-	if a, ok := s.sessions[sid]; ok {
-		return a, true, nil
-	}
-
-	return nil, false, fmt.Errorf("session not found: %s", sid)
+	a, ok := s.sessions[sid]
+	return a, ok, nil
 }
 
 func (s *MemoryStore) Del(ctx context.Context, sid string) error {
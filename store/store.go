@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 )
@@ -28,9 +29,57 @@ type BrowserStorer interface {
 	Del(w http.ResponseWriter, name string) error
 }
 
+// CrossSiteStorer is implemented by browser stores that can derive a store whose values are also
+// sent along with cross-site requests.
+type CrossSiteStorer interface {
+	CrossSite() BrowserStorer
+}
+
 type SessionStorer interface {
 	Set(ctx context.Context, sid string, value interface{}, duration time.Duration) (
 		SessionResultReporter, error)
 	Get(ctx context.Context, sid string) (interface{}, bool, error)
 	Del(ctx context.Context, sid string) error
 }
+
+// TypedSessionStorer is a SessionStorer whose values are of type T, sparing callers type
+// assertions and letting stores that serialize values know what type to decode them into.
+type TypedSessionStorer[T any] interface {
+	Set(ctx context.Context, sid string, value T, duration time.Duration) (
+		SessionResultReporter, error)
+	Get(ctx context.Context, sid string) (T, bool, error)
+	Del(ctx context.Context, sid string) error
+}
+
+// Typed adapts a SessionStorer to a TypedSessionStorer.  Retrieving a value of a type other than T
+// results in an error.
+func Typed[T any](s SessionStorer) TypedSessionStorer[T] {
+	return &typedStore[T]{s}
+}
+
+type typedStore[T any] struct {
+	store SessionStorer
+}
+
+func (s *typedStore[T]) Set(ctx context.Context, sid string, value T, duration time.Duration) (
+	SessionResultReporter, error) {
+	return s.store.Set(ctx, sid, value, duration)
+}
+
+func (s *typedStore[T]) Get(ctx context.Context, sid string) (T, bool, error) {
+	var zero T
+	v, ok, err := s.store.Get(ctx, sid)
+	if err != nil || !ok {
+		return zero, ok, err
+	}
+
+	value, ok := v.(T)
+	if !ok {
+		return zero, false, fmt.Errorf("unexpected session type: %T", v)
+	}
+	return value, true, nil
+}
+
+func (s *typedStore[T]) Del(ctx context.Context, sid string) error {
+	return s.store.Del(ctx, sid)
+}